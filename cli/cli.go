@@ -2,13 +2,32 @@ package cli
 
 import (
 	"blockchain/core"
+	"blockchain/network"
+	"blockchain/rpc"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/boltdb/bolt"
-	"github.com/btcsuite/btcutil/base58"
 	"log"
+	"math"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"time"
+)
+
+// Exit codes of failed commands. Wrong usage exits with exitFailure as well
+const (
+	exitFailure           = 1
+	exitChainState        = 2
+	exitInsufficientFunds = 3
+	exitBadAddress        = 4
+	exitNotFound          = 5
+	exitInvalid           = 6
 )
 
 type Cli struct {
@@ -21,17 +40,94 @@ func (cli *Cli) Active() {
 		os.Exit(1)
 	}
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	showBlocksCmd := flag.NewFlagSet("showblocks", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	getBlockHashCmd := flag.NewFlagSet("getblockhash", flag.ExitOnError)
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
+	getSupplyCmd := flag.NewFlagSet("getsupply", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
 	showAddrsCmd := flag.NewFlagSet("showaddresses", flag.ExitOnError)
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	reindexTxCmd := flag.NewFlagSet("reindextx", flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet("gettransaction", flag.ExitOnError)
+	rollbackCmd := flag.NewFlagSet("rollback", flag.ExitOnError)
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	getPubKeyCmd := flag.NewFlagSet("getpubkey", flag.ExitOnError)
+	createMultiSigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	createMultiSigTxCmd := flag.NewFlagSet("createmultisigtx", flag.ExitOnError)
+	signMultiSigTxCmd := flag.NewFlagSet("signmultisigtx", flag.ExitOnError)
+	sendMultiSigTxCmd := flag.NewFlagSet("sendmultisigtx", flag.ExitOnError)
+	sendRawTxCmd := flag.NewFlagSet("sendrawtransaction", flag.ExitOnError)
+	anchorCmd := flag.NewFlagSet("anchor", flag.ExitOnError)
+	findAnchorCmd := flag.NewFlagSet("findanchor", flag.ExitOnError)
 
 	sendFrom := sendCmd.String("from", "", "Source address")
 	sendTo := sendCmd.String("to", "", "Destination address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
-	createBlockchainAddr := createBlockchainCmd.String("address", "", "First Miner's address")
+	sendFee := sendCmd.Int("fee", 0, "Fee to pay to the miner")
+	sendFeeRate := sendCmd.Int("feerate", 0, "Fee in coins per byte of the transaction to pay to the miner")
+	sendNode := sendCmd.String("node", "", "Node address to relay the transaction to instead of the local mempool")
+	sendLockTime := sendCmd.Uint("locktime", 0, "Block height, or unix time from 500000000 on, before which the transaction can't be mined")
+	sendFile := sendCmd.String("file", "", "File to write the signed transaction to instead of sending it, e.g. until its lock time")
+	sendData := sendCmd.String("data", "", "Hex data of at most 80 bytes to carry in an unspendable output")
+	mineAddress := mineCmd.String("address", "", "Address to receive rewards")
+	mineBlocks := mineCmd.Int("blocks", 1, "Number of blocks to mine")
+	createBlockchainAuthorities := createBlockchainCmd.String("authorities", "", "Comma separated addresses which sign blocks in turn instead of mining them")
+	getBlockHash := getBlockCmd.String("hash", "", "Hash of the block")
+	getBlockHeight := getBlockCmd.Int("height", -1, "Height of the block in the main chain")
+	getBlockJSON := getBlockCmd.Bool("json", false, "Print the block as JSON")
+	getBlockHashHeight := getBlockHashCmd.Int("height", -1, "Height of the block in the main chain")
+	getTransactionID := getTransactionCmd.String("id", "", "ID of the transaction")
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
+	rollbackBlocks := rollbackCmd.Int("blocks", 0, "Number of blocks to disconnect from the tip")
+	startNodePort := startNodeCmd.Int("port", 0, "Port to listen on, the default port of the network if not given")
+	startNodeSeeds := startNodeCmd.String("seeds", "", "Comma separated addresses of nodes to connect to")
+	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining and send rewards to this address")
+	startNodeRPCPort := startNodeCmd.Int("rpcport", 0, "Port to serve JSON-RPC on localhost at, the default RPC port of the network if not given")
+	startNodeRPCUser := startNodeCmd.String("rpcuser", "", "User name for JSON-RPC basic auth")
+	startNodeRPCPassword := startNodeCmd.String("rpcpassword", "", "Password for JSON-RPC basic auth")
+	getPubKeyAddress := getPubKeyCmd.String("address", "", "Wallet address to print the public key of")
+	createMultiSigM := createMultiSigCmd.Int("m", 0, "Number of signatures required to spend")
+	createMultiSigPubKeys := createMultiSigCmd.String("pubkeys", "", "Comma separated hex public keys")
+	createMultiSigTxFrom := createMultiSigTxCmd.String("from", "", "Multisig address to spend from")
+	createMultiSigTxTo := createMultiSigTxCmd.String("to", "", "Destination address")
+	createMultiSigTxAmount := createMultiSigTxCmd.Int("amount", 0, "Amount to send")
+	createMultiSigTxFee := createMultiSigTxCmd.Int("fee", 0, "Fee to pay to the miner")
+	createMultiSigTxFile := createMultiSigTxCmd.String("file", "", "File to write the unsigned transaction to")
+	createMultiSigTxRedeemScript := createMultiSigTxCmd.String("redeemscript", "", "Hex multisig script of a pay to script hash address")
+	signMultiSigTxFile := signMultiSigTxCmd.String("file", "", "File of the transaction to add signatures to")
+	sendMultiSigTxFile := sendMultiSigTxCmd.String("file", "", "File of the fully signed transaction")
+	sendMultiSigTxNode := sendMultiSigTxCmd.String("node", "", "Node address to relay the transaction to instead of the local mempool")
+	sendRawTxFile := sendRawTxCmd.String("file", "", "File of the transaction written by send -file")
+	sendRawTxNode := sendRawTxCmd.String("node", "", "Node address to relay the transaction to instead of the local mempool")
+	anchorFrom := anchorCmd.String("from", "", "Address paying the fee")
+	anchorFile := anchorCmd.String("file", "", "File whose SHA-256 hash is anchored")
+	anchorFee := anchorCmd.Int("fee", 0, "Fee to pay to the miner")
+	anchorFeeRate := anchorCmd.Int("feerate", 0, "Fee in coins per byte of the transaction to pay to the miner")
+	anchorNode := anchorCmd.String("node", "", "Node address to relay the transaction to instead of the local mempool")
+	findAnchorFile := findAnchorCmd.String("file", "", "File whose anchored SHA-256 hash is looked up")
+	findAnchorData := findAnchorCmd.String("data", "", "Hex data which is looked up")
+
+	// Every command accepts -datadir, -network and -nodeid
+	config := core.DefaultConfig()
+	config.NodeID = os.Getenv("NODE_ID")
+	for _, cmd := range []*flag.FlagSet{
+		sendCmd, mineCmd, createBlockchainCmd, showBlocksCmd, getBlockCmd, getBlockHashCmd,
+		getBalanceCmd, getSupplyCmd, createWalletCmd, showAddrsCmd, reindexUTXOCmd, reindexTxCmd,
+		getTransactionCmd, rollbackCmd, startNodeCmd, getPubKeyCmd, createMultiSigCmd, createMultiSigTxCmd,
+		signMultiSigTxCmd, sendMultiSigTxCmd, sendRawTxCmd, anchorCmd, findAnchorCmd,
+	} {
+		cmd.Func("datadir", "Directory to keep blockchain and wallet files in (default "+config.DataDir+")", func(dir string) error {
+			// Files of older versions are only looked for in the default place
+			config.DataDir = dir
+			config.LegacyDir = ""
+			return nil
+		})
+		cmd.StringVar(&config.Network, "network", config.Network, "Network to use: mainnet, testnet or regtest")
+		cmd.StringVar(&config.NodeID, "nodeid", config.NodeID, "ID added to the names of the node's blockchain and wallet files, NODE_ID if not given")
+	}
 
 	switch os.Args[1] {
 	case "send":
@@ -39,6 +135,11 @@ func (cli *Cli) Active() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "mine":
+		err := mineCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "createblockchain":
 		err := createBlockchainCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -49,11 +150,26 @@ func (cli *Cli) Active() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "getblock":
+		err := getBlockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getblockhash":
+		err := getBlockHashCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "getbalance":
 		err := getBalanceCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "getsupply":
+		err := getSupplyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "createwallet":
 		err := createWalletCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -64,29 +180,126 @@ func (cli *Cli) Active() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "reindexutxo":
+		err := reindexUTXOCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindextx":
+		err := reindexTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "gettransaction":
+		err := getTransactionCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "rollback":
+		err := rollbackCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "startnode":
+		err := startNodeCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getpubkey":
+		err := getPubKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createmultisig":
+		err := createMultiSigCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createmultisigtx":
+		err := createMultiSigTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signmultisigtx":
+		err := signMultiSigTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "sendmultisigtx":
+		err := sendMultiSigTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "sendrawtransaction":
+		err := sendRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "anchor":
+		err := anchorCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "findanchor":
+		err := findAnchorCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	default:
 		cli.printUsage()
 		os.Exit(1)
 	}
 
+	var err error
+
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		// -data alone sends no coins but the fee
+		if *sendFrom == "" || (*sendTo == "" && *sendData == "") || (*sendTo != "") != (*sendAmount > 0) || *sendAmount < 0 ||
+			*sendFee < 0 || *sendFeeRate < 0 || *sendLockTime > math.MaxUint32 {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		if *sendFee > 0 && *sendFeeRate > 0 {
+			fmt.Println("Use either -fee or -feerate")
+			os.Exit(1)
+		}
+		err = cli.send(*sendFrom, *sendTo, *sendAmount, *sendData, *sendFee, *sendFeeRate, uint32(*sendLockTime), *sendNode, *sendFile, config)
 	}
 
-	if createBlockchainCmd.Parsed() {
-		if *createBlockchainAddr == "" {
-			createBlockchainCmd.Usage()
+	if mineCmd.Parsed() {
+		if *mineAddress == "" || *mineBlocks <= 0 {
+			mineCmd.Usage()
 			os.Exit(1)
 		}
-		cli.createBlockchain(*createBlockchainAddr)
+		err = cli.mine(*mineAddress, *mineBlocks, config)
+	}
+
+	if createBlockchainCmd.Parsed() {
+		var authorities []string
+		if *createBlockchainAuthorities != "" {
+			authorities = strings.Split(*createBlockchainAuthorities, ",")
+		}
+		err = cli.createBlockchain(authorities, config)
 	}
 
 	if showBlocksCmd.Parsed() {
-		cli.showBlocks()
+		err = cli.showBlocks(config)
+	}
+
+	if getBlockCmd.Parsed() {
+		if (*getBlockHash == "") == (*getBlockHeight < 0) {
+			getBlockCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.getBlock(*getBlockHash, *getBlockHeight, *getBlockJSON, config)
+	}
+
+	if getBlockHashCmd.Parsed() {
+		if *getBlockHashHeight < 0 {
+			getBlockHashCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.getBlockHash(*getBlockHashHeight, config)
 	}
 
 	if getBalanceCmd.Parsed() {
@@ -94,115 +307,950 @@ func (cli *Cli) Active() {
 			getBalanceCmd.Usage()
 			os.Exit(1)
 		}
-		cli.getBalance(*getBalanceAddress)
+		err = cli.getBalance(*getBalanceAddress, config)
+	}
+
+	if getSupplyCmd.Parsed() {
+		err = cli.getSupply(config)
 	}
 
 	if createWalletCmd.Parsed() {
-		cli.createWallet()
+		err = cli.createWallet(config)
 	}
 
 	if showAddrsCmd.Parsed() {
-		cli.showAddresses()
+		err = cli.showAddresses(config)
+	}
+
+	if reindexUTXOCmd.Parsed() {
+		err = cli.reindexUTXO(config)
+	}
+
+	if reindexTxCmd.Parsed() {
+		err = cli.reindexTx(config)
+	}
+
+	if getTransactionCmd.Parsed() {
+		if *getTransactionID == "" {
+			getTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.getTransaction(*getTransactionID, config)
+	}
+
+	if rollbackCmd.Parsed() {
+		if *rollbackBlocks <= 0 {
+			rollbackCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.rollback(*rollbackBlocks, config)
 	}
+
+	if startNodeCmd.Parsed() {
+		if *startNodePort < 0 || *startNodeRPCPort < 0 {
+			startNodeCmd.Usage()
+			os.Exit(1)
+		}
+		if (*startNodeRPCPort > 0 || *startNodeRPCUser != "") && (*startNodeRPCUser == "" || *startNodeRPCPassword == "") {
+			fmt.Println("-rpcuser and -rpcpassword are required with -rpcport")
+			os.Exit(1)
+		}
+		err = cli.startNode(*startNodePort, *startNodeSeeds, *startNodeMiner, *startNodeRPCPort, *startNodeRPCUser, *startNodeRPCPassword, config)
+	}
+
+	if getPubKeyCmd.Parsed() {
+		if *getPubKeyAddress == "" {
+			getPubKeyCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.getPubKey(*getPubKeyAddress, config)
+	}
+
+	if createMultiSigCmd.Parsed() {
+		if *createMultiSigM <= 0 || *createMultiSigPubKeys == "" {
+			createMultiSigCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.createMultiSig(*createMultiSigM, strings.Split(*createMultiSigPubKeys, ","), config)
+	}
+
+	if createMultiSigTxCmd.Parsed() {
+		if *createMultiSigTxFrom == "" || *createMultiSigTxTo == "" || *createMultiSigTxAmount <= 0 ||
+			*createMultiSigTxFee < 0 || *createMultiSigTxFile == "" {
+			createMultiSigTxCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.createMultiSigTx(*createMultiSigTxFrom, *createMultiSigTxTo, *createMultiSigTxAmount, *createMultiSigTxFee,
+			*createMultiSigTxRedeemScript, *createMultiSigTxFile, config)
+	}
+
+	if signMultiSigTxCmd.Parsed() {
+		if *signMultiSigTxFile == "" {
+			signMultiSigTxCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.signMultiSigTx(*signMultiSigTxFile, config)
+	}
+
+	if sendMultiSigTxCmd.Parsed() {
+		if *sendMultiSigTxFile == "" {
+			sendMultiSigTxCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.sendMultiSigTx(*sendMultiSigTxFile, *sendMultiSigTxNode, config)
+	}
+
+	if sendRawTxCmd.Parsed() {
+		if *sendRawTxFile == "" {
+			sendRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.sendRawTx(*sendRawTxFile, *sendRawTxNode, config)
+	}
+
+	if anchorCmd.Parsed() {
+		if *anchorFrom == "" || *anchorFile == "" || *anchorFee < 0 || *anchorFeeRate < 0 {
+			anchorCmd.Usage()
+			os.Exit(1)
+		}
+		if *anchorFee > 0 && *anchorFeeRate > 0 {
+			fmt.Println("Use either -fee or -feerate")
+			os.Exit(1)
+		}
+		err = cli.anchor(*anchorFrom, *anchorFile, *anchorFee, *anchorFeeRate, *anchorNode, config)
+	}
+
+	if findAnchorCmd.Parsed() {
+		if (*findAnchorFile == "") == (*findAnchorData == "") {
+			findAnchorCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.findAnchor(*findAnchorFile, *findAnchorData, config)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode tells scripts what kind of failure stopped the command
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, core.ErrNoBlockchain), errors.Is(err, core.ErrBlockchainExists), errors.Is(err, core.ErrLegacyBlockchain),
+		errors.Is(err, core.ErrBlockchainInUse):
+		return exitChainState
+	case errors.Is(err, core.ErrInsufficientFunds):
+		return exitInsufficientFunds
+	case errors.Is(err, core.ErrUnknownAddress), errors.Is(err, core.ErrInvalidAddress), errors.Is(err, core.ErrWrongNetwork),
+		errors.Is(err, core.ErrNotAuthority), errors.Is(err, core.ErrNotMultiSig), errors.Is(err, core.ErrRedeemScriptMismatch):
+		return exitBadAddress
+	case errors.Is(err, core.ErrBlockNotFound), errors.Is(err, core.ErrTransactionNotFound), errors.Is(err, core.ErrDataNotFound):
+		return exitNotFound
+	}
+
+	var validationErr *core.ValidationError
+	if errors.As(err, &validationErr) {
+		return exitInvalid
+	}
+
+	return exitFailure
+}
+
+// send sends amount from a wallet address to address to and hex data in a data output, if they are given.
+// With file the transaction is written there instead, so a transaction whose lock time
+// isn't reached yet can be sent later with sendRawTx
+func (cli *Cli) send(from, to string, amount int, data string, fee, feeRate int, lockTime uint32, node, file string, config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	var outputs []core.TXOutput
+	if to != "" {
+		out, err := core.NewTXOutput(amount, to, bc.Params())
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, *out)
+	}
+	if data != "" {
+		payload, err := hex.DecodeString(data)
+		if err != nil {
+			return fmt.Errorf("data is not hex: %w", err)
+		}
+		out, err := core.NewDataOutput(payload)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, *out)
+	}
+
+	mempool, err := core.LoadMempool(bc)
+	if err != nil {
+		return err
+	}
+	UTXOSet := core.UTXOSet{Blockchain: bc, Mempool: mempool}
+	var tx *core.Transaction
+	if feeRate > 0 {
+		tx, err = core.NewWalletTransactionWithFeeRate(from, outputs, feeRate, lockTime, &UTXOSet)
+	} else {
+		tx, err = core.NewWalletTransaction(from, outputs, fee, lockTime, &UTXOSet)
+	}
+	if err != nil {
+		return err
+	}
+
+	if file != "" {
+		err = os.WriteFile(file, []byte(hex.EncodeToString(tx.Serialize())), 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Transaction %x is written to %s. Send it with sendrawtransaction\n", tx.ID, file)
+		return nil
+	}
+
+	return submitTx(tx, mempool, node, bc.Params())
 }
 
-func (cli *Cli) send(from, to string, amount int) {
-	bc := core.GetBlockchain()
-	defer func(Db *bolt.DB) {
-		err := Db.Close()
+// submitTx sends a transaction to node or, if node is empty, adds it to the saved local mempool
+func submitTx(tx *core.Transaction, mempool *core.Mempool, node string, params *core.ChainParams) error {
+	if node != "" {
+		err := network.SendTx(node, tx, params)
 		if err != nil {
+			return err
+		}
+		fmt.Printf("Transaction %x is sent to %s\n", tx.ID, node)
+		return nil
+	}
+
+	err := mempool.Add(tx)
+	if err != nil {
+		return err
+	}
+	err = mempool.Save()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Transaction %x is added to the mempool. Mine a block to confirm it\n", tx.ID)
+
+	return nil
+}
+
+// mine mines blocks with the transactions in the local mempool and rewards address
+func (cli *Cli) mine(address string, blocks int, config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	_, err = bc.Params().DecodeAddress(address)
+	if err != nil {
+		return err
+	}
+	err = setSigner(bc, address, config)
+	if err != nil {
+		return err
+	}
+	mempool, err := core.LoadMempool(bc)
+	if err != nil {
+		return err
+	}
+
+	// Ctrl-C stops mining of the current block
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
+	for i := 0; i < blocks; i++ {
+		block, err := bc.MineBlock(ctx, address, mempool, func(hashesPerSecond float64) {
+			fmt.Printf("Mining at %.0f hashes per second\n", hashesPerSecond)
+		})
+		if err != nil {
+			return err
 		}
-	}(bc.Db)
-	tx := core.NewUTXOTransaction(from, to, amount, bc)
-	rwTx := core.NewCoinbaseTX(from, "Mining reward")
-	bc.AddBlock([]*core.Transaction{rwTx, tx})
-	fmt.Println("Send Complete!!")
+		fmt.Printf("Mined block %x at height %d with %d transactions\n", block.Hash, block.Height, len(block.Transactions)-1)
+	}
+
+	return mempool.Save()
 }
 
-func (cli *Cli) createBlockchain(address string) {
-	newBc := core.CreateBlockchain(address)
+// setSigner makes the wallet of address sign blocks if the blockchain uses proof of authority
+func setSigner(bc *core.Blockchain, address string, config *core.Config) error {
+	engine, ok := bc.Engine().(*core.PoAEngine)
+	if !ok {
+		return nil
+	}
+
+	wallets, err := core.NewWallets(config)
+	if err != nil {
+		return err
+	}
+	wallet, err := wallets.GetWallet(address)
+	if err != nil {
+		return err
+	}
+
+	return engine.SetSigner(&wallet)
+}
+
+func (cli *Cli) createBlockchain(authorities []string, config *core.Config) error {
+	newBc, err := core.CreateBlockchain(authorities, config)
+	if err != nil {
+		return err
+	}
 	newBc.Db.Close()
 	fmt.Println("Successfully done with create blockchain!")
+
+	return nil
 }
 
 // Show Blockchains
-func (cli *Cli) showBlocks() {
-	bc := core.GetBlockchain()
+func (cli *Cli) showBlocks(config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
 	defer bc.Db.Close()
+
 	bcI := bc.Iterator()
 	for {
-		block := bcI.GetNextBlock()
-		pow := core.NewProofOfWork(block)
-
-		fmt.Println("\nTimeStamp:", block.TimeStamp)
-		for index := range block.Transactions {
-			fmt.Println("Transactions: ")
-			fmt.Printf(" ID: %v\n", block.Transactions[index].ID)
-			fmt.Printf(" Vin: %v\n", block.Transactions[index].Vin[0])
-			fmt.Printf("    .ScriptSig: %v\n", block.Transactions[index].Vin[0].ScriptSig)
-			fmt.Printf(" Vout: %v\n", block.Transactions[index].Vout)
-		}
-		fmt.Printf("Hash: %x\n", block.Hash)
-		fmt.Printf("Prev Hash: %x\n", block.PrevHash)
-		fmt.Printf("Nonce: %d\n", block.Nonce)
-		fmt.Printf("is Validated: %s\n", strconv.FormatBool(pow.Validate()))
+		block, err := bcI.GetNextBlock()
+		if err != nil {
+			return err
+		}
+		printBlock(block, bc.Engine())
 
 		if len(block.PrevHash) == 0 {
 			break
 		}
 	}
+
+	return nil
+}
+
+func printBlock(block *core.Block, engine core.ConsensusEngine) {
+	fmt.Println("\nHeight:", block.Height)
+	fmt.Println("TimeStamp:", block.TimeStamp)
+	for index := range block.Transactions {
+		fmt.Println("Transactions: ")
+		fmt.Printf(" ID: %v\n", block.Transactions[index].ID)
+		fmt.Printf(" Vin: %v\n", block.Transactions[index].Vin[0])
+		fmt.Printf("    .ScriptSig: %s\n", core.DisasmScript(block.Transactions[index].Vin[0].ScriptSig))
+		fmt.Printf(" Vout: %v\n", block.Transactions[index].Vout)
+	}
+	fmt.Printf("Hash: %x\n", block.Hash)
+	fmt.Printf("Prev Hash: %x\n", block.PrevHash)
+	fmt.Printf("Merkle Root: %x\n", block.MerkleRoot)
+	fmt.Printf("Bits: %08x\n", block.Bits)
+	fmt.Printf("Nonce: %d\n", block.Nonce)
+	if block.Signer != nil {
+		fmt.Printf("Signer: %x\n", block.Signer)
+	}
+	fmt.Printf("is Validated: %s\n", strconv.FormatBool(engine.VerifySeal(block) == nil))
+}
+
+// getBlock prints a block found by its hash or by its height in the main chain
+func (cli *Cli) getBlock(hash string, height int, asJSON bool, config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	var block core.Block
+	if hash != "" {
+		blockHash, err := hex.DecodeString(hash)
+		if err != nil {
+			return err
+		}
+		block, err = bc.GetBlock(blockHash)
+		if err != nil {
+			return err
+		}
+	} else {
+		block, err = bc.GetBlockByHeight(height)
+		if err != nil {
+			return err
+		}
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(block, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printBlock(&block, bc.Engine())
+
+	return nil
 }
 
-func (cli *Cli) getBalance(address string) {
-	bc := core.GetBlockchain()
+// getBlockHash prints the hash of the main chain block at height
+func (cli *Cli) getBlockHash(height int, config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
 	defer bc.Db.Close()
 
+	hash, err := bc.GetBlockHash(height)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%x\n", hash)
+	return nil
+}
+
+func (cli *Cli) getBalance(address string, config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	UTXOSet := core.UTXOSet{Blockchain: bc}
 	balance := 0
 
-	publicKeyHash, _, err := base58.CheckDecode(address)
+	script, err := bc.Params().AddressScript(address)
+	if err != nil {
+		return err
+	}
+	UTXOs, err := UTXOSet.FindUTXOs(script)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-	utxs := bc.FindUnspentTxs(publicKeyHash)
 
-	for _, tx := range utxs {
-		for _, out := range tx.Vout {
-			if out.IsLockedWithKey(publicKeyHash) {
-				balance += out.Value
-			}
-		}
+	for _, out := range UTXOs {
+		balance += out.Value
+	}
+
+	immatureUTXOs, err := UTXOSet.FindImmatureUTXOs(script)
+	if err != nil {
+		return err
+	}
+	immature := 0
+	for _, out := range immatureUTXOs {
+		immature += out.Value
 	}
 
 	fmt.Printf("Balance of '%s': %d\n", address, balance)
+	fmt.Printf("Immature: %d\n", immature)
+	return nil
+}
+
+// getSupply prints how many coins are issued so far against the maximum supply
+func (cli *Cli) getSupply(config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	UTXOSet := core.UTXOSet{Blockchain: bc}
+	unspent, err := UTXOSet.TotalValue()
+	if err != nil {
+		return err
+	}
+	params := bc.Params()
+
+	fmt.Println("Height:", bestHeight)
+	fmt.Println("Block subsidy:", params.BlockSubsidy(bestHeight+1))
+	fmt.Println("Issued:", params.IssuedSupply(bestHeight))
+	fmt.Println("Unspent:", unspent)
+	fmt.Println("Max supply:", params.MaxSupply())
+
+	return nil
 }
 
-func (cli *Cli) createWallet() {
-	wallets, _ := core.NewWallets()
-	address := wallets.CreateWallet()
-	wallets.SaveToFile()
+func (cli *Cli) createWallet(config *core.Config) error {
+	wallets, err := core.NewWallets(config)
+	if err != nil {
+		return err
+	}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		return err
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		return err
+	}
 
 	fmt.Printf("Your new address: %s\n", address)
+	return nil
 }
 
-func (cli *Cli) showAddresses() {
-	wallets, err := core.NewWallets()
+func (cli *Cli) showAddresses(config *core.Config) error {
+	wallets, err := core.NewWallets(config)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	addresses := wallets.GetAddresses()
 
 	for _, address := range addresses {
 		fmt.Println(address)
 	}
+
+	return nil
+}
+
+func (cli *Cli) reindexUTXO(config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	UTXOSet := core.UTXOSet{Blockchain: bc}
+	err = UTXOSet.Build()
+	if err != nil {
+		return err
+	}
+
+	count, err := UTXOSet.CountTransactions()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+
+	return nil
+}
+
+func (cli *Cli) reindexTx(config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	count, err := bc.ReindexTransactions()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Done! There are %d transactions in the transaction index.\n", count)
+
+	return nil
+}
+
+// getTransaction prints a main chain transaction and the block containing it
+func (cli *Cli) getTransaction(id string, config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	txID, err := hex.DecodeString(id)
+	if err != nil {
+		return err
+	}
+	tx, block, err := bc.FindTransaction(txID)
+	if err != nil {
+		return err
+	}
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Transaction %x\n", tx.ID)
+	fmt.Printf("Block: %x\n", block.Hash)
+	fmt.Println("Height:", block.Height)
+	fmt.Println("Confirmations:", bestHeight-block.Height+1)
+	if tx.LockTime != 0 {
+		fmt.Println("Lock time:", tx.LockTime)
+	}
+
+	fmt.Println("Inputs:")
+	for _, vin := range tx.Vin {
+		if tx.IsCoinbase() {
+			fmt.Println("  coinbase")
+			continue
+		}
+		if vin.Sequence != 0 {
+			fmt.Printf("  %x:%d sequence %d\n", vin.Txid, vin.TxoutIdx, vin.Sequence)
+			continue
+		}
+		fmt.Printf("  %x:%d\n", vin.Txid, vin.TxoutIdx)
+	}
+
+	fmt.Println("Outputs:")
+	for index, out := range tx.Vout {
+		to := out.Address(bc.Params())
+		if to == "" {
+			to = core.DisasmScript(out.ScriptPubKey)
+		}
+		fmt.Printf("  %d: %d to %s\n", index, out.Value, to)
+	}
+
+	return nil
+}
+
+func (cli *Cli) rollback(blocks int, config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	err = bc.Rollback(blocks)
+	if err != nil {
+		return err
+	}
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rolled back %d blocks. Height is now %d\n", blocks, height)
+	return nil
+}
+
+func (cli *Cli) startNode(port int, seeds, minerAddress string, rpcPort int, rpcUser, rpcPassword string, config *core.Config) error {
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	params := bc.Params()
+	if minerAddress != "" {
+		if _, err := params.DecodeAddress(minerAddress); err != nil {
+			return err
+		}
+		if err := setSigner(bc, minerAddress, config); err != nil {
+			return err
+		}
+	}
+	if port == 0 {
+		port = params.DefaultPort
+	}
+	if rpcPort == 0 {
+		rpcPort = params.DefaultRPCPort
+	}
+
+	address := fmt.Sprintf("localhost:%d", port)
+	server, err := network.NewServer(address, minerAddress, strings.Split(seeds, ","), bc)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 2)
+	if rpcUser != "" {
+		rpcServer := rpc.NewServer(fmt.Sprintf("localhost:%d", rpcPort), rpcUser, rpcPassword, bc, server)
+		go func() {
+			errs <- rpcServer.Start()
+		}()
+	}
+	go func() {
+		errs <- server.Start()
+	}()
+
+	return <-errs
 }
 
 func (cli *Cli) printUsage() {
 	fmt.Printf("How to use:\n\n")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT - send AMOUNT of coins from FROM address to TO")
-	fmt.Println("  createblockchain -address ADDRESS - create new blockchain")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT [-data DATA] [-fee FEE | -feerate RATE] [-locktime LOCKTIME] [-node NODE | -file FILE]")
+	fmt.Println("      - Send AMOUNT of coins from FROM address to TO through the local mempool or NODE")
+	fmt.Println("      - FEE is the whole fee in coins, RATE the fee in coins per byte of the transaction")
+	fmt.Println("      - At most 80 bytes of hex DATA are carried in an unspendable output. With DATA, -to and -amount are optional")
+	fmt.Println("      - The transaction can't be mined before LOCKTIME, a block height or from 500000000 on a unix time")
+	fmt.Println("      - With FILE the transaction is written there to be sent later with sendrawtransaction")
+	fmt.Println("  sendrawtransaction -file FILE [-node NODE] - Send the transaction in FILE through the local mempool or NODE")
+	fmt.Println("  anchor -from FROM -file FILE [-fee FEE | -feerate RATE] [-node NODE] - Carry the SHA-256 hash of FILE")
+	fmt.Println("      in an unspendable output, so the chain proves the file existed when the block was mined")
+	fmt.Println("  findanchor -file FILE | -data DATA - Print the first block carrying the hash of FILE or hex DATA")
+	fmt.Println("      with the merkle proof of its transaction")
+	fmt.Println("  mine -address ADDRESS [-blocks N] - Mine N blocks with the local mempool and reward ADDRESS")
+	fmt.Println("      - On a proof of authority chain ADDRESS signs the blocks and must be the authority in turn")
+	fmt.Println("  createblockchain [-authorities ADDRESSES] - create new blockchain from the genesis block of the network")
+	fmt.Println("      - Blocks are signed in turn by the comma separated ADDRESSES if given and mined otherwise")
 	fmt.Println("  showblocks - print all the blocks of the blockchain")
-	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
+	fmt.Println("  getblock -hash HASH | -height HEIGHT [-json] - Print a block by its hash or its height in the main chain")
+	fmt.Println("  getblockhash -height HEIGHT - Print the hash of the main chain block at HEIGHT")
+	fmt.Println("  getbalance -address ADDRESS - Get spendable and immature balance of ADDRESS")
+	fmt.Println("  getsupply - Print issued coins against the maximum supply")
 	fmt.Println("  createwallet - Create your Wallet")
 	fmt.Println("  showaddresses - Show all addresses")
+	fmt.Println("  reindexutxo - Rebuild the UTXO set")
+	fmt.Println("  reindextx - Enable the transaction index and rebuild it")
+	fmt.Println("  gettransaction -id ID - Print a transaction with its block height and confirmations")
+	fmt.Println("  rollback -blocks N - Disconnect the last N blocks. The node follows them again once a new block on top of them is received")
+	fmt.Println("  getpubkey -address ADDRESS - Print the public key of a wallet address")
+	fmt.Println("  createmultisig -m M -pubkeys KEYS - Print the multisig and pay to script hash addresses")
+	fmt.Println("      of M signatures out of the comma separated hex KEYS, and the redeem script")
+	fmt.Println("  createmultisigtx -from MULTISIG -to TO -amount AMOUNT [-fee FEE] [-redeemscript SCRIPT] -file FILE")
+	fmt.Println("      - Write an unsigned transaction spending from MULTISIG to FILE. A pay to script hash")
+	fmt.Println("      MULTISIG address needs its hex redeem SCRIPT")
+	fmt.Println("  signmultisigtx -file FILE - Add signatures of the keys in the wallet file to the transaction in FILE")
+	fmt.Println("  sendmultisigtx -file FILE [-node NODE] - Send the fully signed transaction in FILE through the local mempool or NODE")
+	fmt.Println("  startnode [-port PORT] [-seeds NODES] [-miner ADDRESS] [-rpcport PORT] [-rpcuser USER -rpcpassword PASSWORD]")
+	fmt.Println("      - Start a node, mine blocks if ADDRESS is given and serve JSON-RPC if -rpcuser is given")
+	fmt.Println("        Ports default to the ones of the network")
+	fmt.Println("\nEvery command accepts -datadir DIR, -network mainnet|testnet|regtest and -nodeid ID")
+	fmt.Println("A mainnet wallet file of an older version in the working directory is used until -datadir has its own")
+	fmt.Println("A blockchain file of an older version can't be read, so a new blockchain has to be created")
+	fmt.Println("A running node keeps its blockchain file open, so other commands on its data directory fail")
+}
+
+// getPubKey prints the public key of a wallet address, which others need to create a multisig address with it
+func (cli *Cli) getPubKey(address string, config *core.Config) error {
+	wallets, err := core.NewWallets(config)
+	if err != nil {
+		return err
+	}
+	wallet, err := wallets.GetWallet(address)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%x\n", wallet.PublicKey)
+	return nil
+}
+
+// createMultiSig prints the addresses of outputs spendable with m signatures of pubKeys
+// and the redeem script spenders of the pay to script hash address reveal
+func (cli *Cli) createMultiSig(m int, pubKeys []string, config *core.Config) error {
+	params, err := config.Params()
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	for _, pubKey := range pubKeys {
+		key, err := hex.DecodeString(pubKey)
+		if err != nil {
+			return fmt.Errorf("public key %s is not hex", pubKey)
+		}
+		keys = append(keys, key)
+	}
+	script, err := core.NewMultiSigScript(m, keys)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Multisig address of %d of %d keys: %s\n", m, len(keys), params.ScriptAddress(script))
+	scriptHashAddress, err := params.ScriptHashAddress(script)
+	if err != nil {
+		fmt.Printf("No pay to script hash address: %s\n", err)
+		return nil
+	}
+	fmt.Printf("Pay to script hash address: %s\n", scriptHashAddress)
+	fmt.Printf("Redeem script: %x\n", script)
+
+	return nil
+}
+
+// createMultiSigTx writes an unsigned transaction spending from a multisig address to file
+func (cli *Cli) createMultiSigTx(from, to string, amount, fee int, redeemScriptHex, file string, config *core.Config) error {
+	redeemScript, err := hex.DecodeString(redeemScriptHex)
+	if err != nil {
+		return fmt.Errorf("redeem script is not hex: %w", err)
+	}
+
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	mempool, err := core.LoadMempool(bc)
+	if err != nil {
+		return err
+	}
+	UTXOSet := core.UTXOSet{Blockchain: bc, Mempool: mempool}
+	ptx, err := core.NewMultiSigTransaction(from, to, amount, fee, redeemScript, &UTXOSet)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(file, ptx.Serialize(), 0644)
+	if err != nil {
+		return err
+	}
+	_, need := ptx.Status()
+	fmt.Printf("Transaction needs %d signatures. Sign %s with signmultisigtx\n", need, file)
+
+	return nil
+}
+
+// signMultiSigTx adds signatures of every key in the wallet file to the transaction in file
+func (cli *Cli) signMultiSigTx(file string, config *core.Config) error {
+	ptx, err := readPartialTransaction(file)
+	if err != nil {
+		return err
+	}
+	wallets, err := core.NewWallets(config)
+	if err != nil {
+		return err
+	}
+
+	signed := 0
+	for _, address := range wallets.GetAddresses() {
+		wallet, err := wallets.GetWallet(address)
+		if err != nil {
+			return err
+		}
+		n, err := ptx.Sign(&wallet)
+		if err != nil {
+			return err
+		}
+		signed += n
+	}
+	if signed == 0 {
+		return core.ErrNothingToSign
+	}
+
+	err = os.WriteFile(file, ptx.Serialize(), 0644)
+	if err != nil {
+		return err
+	}
+	have, need := ptx.Status()
+	fmt.Printf("Added %d signatures. Transaction has %d of %d signatures\n", signed, have, need)
+
+	return nil
+}
+
+// sendMultiSigTx finalizes the transaction in file and sends it like send does
+func (cli *Cli) sendMultiSigTx(file, node string, config *core.Config) error {
+	ptx, err := readPartialTransaction(file)
+	if err != nil {
+		return err
+	}
+	tx, err := ptx.Finalize()
+	if err != nil {
+		return err
+	}
+
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	mempool, err := core.LoadMempool(bc)
+	if err != nil {
+		return err
+	}
+
+	return submitTx(tx, mempool, node, bc.Params())
+}
+
+func readPartialTransaction(file string) (*core.PartialTransaction, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.DeserializePartialTransaction(data)
+}
+
+// sendRawTx sends a transaction written by send -file
+func (cli *Cli) sendRawTx(file, node string, config *core.Config) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("transaction is not hex: %w", err)
+	}
+	tx, err := core.DeserializeTransaction(raw)
+	if err != nil {
+		return err
+	}
+
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	mempool, err := core.LoadMempool(bc)
+	if err != nil {
+		return err
+	}
+
+	return submitTx(&tx, mempool, node, bc.Params())
+}
+
+// anchor sends the SHA-256 hash of a file in a data output
+func (cli *Cli) anchor(from, file string, fee, feeRate int, node string, config *core.Config) error {
+	hash, err := fileHash(file)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("SHA-256 of %s: %x\n", file, hash)
+	return cli.send(from, "", 0, hex.EncodeToString(hash), fee, feeRate, 0, node, "", config)
+}
+
+// findAnchor prints the block carrying the hash of a file or hex data,
+// the merkle proof of the transaction carrying it and whether the proof holds
+func (cli *Cli) findAnchor(file, data string, config *core.Config) error {
+	var payload []byte
+	var err error
+	if file != "" {
+		payload, err = fileHash(file)
+	} else {
+		payload, err = hex.DecodeString(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	bc, err := core.GetBlockchain(config)
+	if err != nil {
+		return err
+	}
+	defer bc.Db.Close()
+
+	anchor, err := bc.FindAnchor(payload)
+	if err != nil {
+		return err
+	}
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Data %x\n", payload)
+	fmt.Printf("Transaction: %x output %d\n", anchor.Tx.ID, anchor.Output)
+	fmt.Printf("Block: %x\n", anchor.Block.Hash)
+	fmt.Println("Height:", anchor.Block.Height)
+	fmt.Println("Confirmations:", bestHeight-anchor.Block.Height+1)
+	fmt.Printf("Time: %s\n", time.Unix(int64(anchor.Block.TimeStamp), 0).UTC().Format(time.RFC3339))
+	fmt.Printf("Merkle Root: %x\n", anchor.Block.MerkleRoot)
+	fmt.Println("Merkle proof:")
+	for _, step := range anchor.Proof {
+		side := "right"
+		if step.Left {
+			side = "left"
+		}
+		fmt.Printf("  %s %x\n", side, step.Hash)
+	}
+	fmt.Printf("Proof valid: %s\n", strconv.FormatBool(anchor.Verify(payload)))
+
+	return nil
+}
+
+// fileHash returns the SHA-256 hash of a file
+func fileHash(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+
+	return hash[:], nil
 }
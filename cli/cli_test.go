@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"blockchain/core"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSendWhileNodeRuns(t *testing.T) {
+	config := &core.Config{DataDir: t.TempDir(), Network: core.RegTest}
+	wallets, err := core.NewWallets(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The node keeps the blockchain file open while it runs
+	bc, err := core.CreateBlockchain(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Db.Close()
+
+	cli := Cli{}
+	err = cli.send(address, address, 1, "", 0, 0, 0, "localhost:1", "", config)
+	if !errors.Is(err, core.ErrBlockchainInUse) {
+		t.Fatalf("send returned %v, want %v", err, core.ErrBlockchainInUse)
+	}
+	if code := exitCode(err); code != exitChainState {
+		t.Fatalf("exit code is %d, want %d", code, exitChainState)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{core.ErrNoBlockchain, exitChainState},
+		{fmt.Errorf("dir: %w", core.ErrLegacyBlockchain), exitChainState},
+		{core.ErrInsufficientFunds, exitInsufficientFunds},
+		{core.ErrWrongNetwork, exitBadAddress},
+		{core.ErrTransactionNotFound, exitNotFound},
+		{&core.ValidationError{TxID: []byte{1}, Err: core.ErrNonStandard}, exitInvalid},
+		{errors.New("disk is full"), exitFailure},
+	}
+
+	for _, tt := range tests {
+		if code := exitCode(tt.err); code != tt.want {
+			t.Errorf("exit code of %v is %d, want %d", tt.err, code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrDataTooLarge = fmt.Errorf("data output carries at most %d bytes", MaxDataSize)
+	ErrDataNotFound = errors.New("no data output of the main chain carries the data")
+)
+
+// NewDataOutput creates an output carrying data, which nobody can spend.
+// It holds no value, so no coins are burnt
+func NewDataOutput(data []byte) (*TXOutput, error) {
+	if len(data) > MaxDataSize {
+		return nil, ErrDataTooLarge
+	}
+
+	return &TXOutput{0, nullDataOutputScript(data)}, nil
+}
+
+// Anchor is where data is carried in the main chain. Proof leads from the transaction ID
+// to the merkle root of the block header, so it shows the block contains the data
+type Anchor struct {
+	Block  *Block
+	Tx     *Transaction
+	Output int
+	Proof  []MerkleStep
+}
+
+// Verify checks the output of the anchor carries data and the proof leads from the hash of its transaction
+// to the merkle root and the hash of its block. Tx.ID is not trusted, as it is not part of the hashed data
+func (a *Anchor) Verify(data []byte) bool {
+	if a.Output < 0 || a.Output >= len(a.Tx.Vout) {
+		return false
+	}
+	carried, ok := extractData(a.Tx.Vout[a.Output].ScriptPubKey)
+	if !ok || !bytes.Equal(carried, data) {
+		return false
+	}
+
+	return bytes.Equal(a.Block.BlockHeader.Hash(), a.Block.Hash) &&
+		VerifyMerkleProof(a.Tx.Hash(), a.Proof, a.Block.MerkleRoot)
+}
+
+// FindAnchor returns the first block of the main chain with a data output carrying data
+func (bc *Blockchain) FindAnchor(data []byte) (*Anchor, error) {
+	var anchor *Anchor
+
+	bcI := bc.Iterator()
+	for {
+		block, err := bcI.GetNextBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		for position, tx := range block.Transactions {
+			for index, out := range tx.Vout {
+				carried, ok := extractData(out.ScriptPubKey)
+				if !ok || !bytes.Equal(carried, data) {
+					continue
+				}
+
+				// Blocks are visited from the last one, so an earlier anchor replaces a later one
+				var ids [][]byte
+				for _, blockTx := range block.Transactions {
+					ids = append(ids, blockTx.ID)
+				}
+				anchor = &Anchor{block, tx, index, NewMerkleTree(ids).Proof(position)}
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	if anchor == nil {
+		return nil, ErrDataNotFound
+	}
+
+	return anchor, nil
+}
@@ -0,0 +1,48 @@
+package core
+
+import "testing"
+
+func TestAnchor(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+	mineBlocks(t, bc, address, mp, bc.params.CoinbaseMaturity)
+
+	data := []byte("anchored data")
+	out, err := NewDataOutput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := NewWalletTransaction(address, []TXOutput{*out}, 0, 0, &UTXOSet{bc, mp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mp.Add(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, address, mp, 1)
+
+	anchor, err := bc.FindAnchor(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !anchor.Verify(data) {
+		t.Fatal("anchor is not verified")
+	}
+	if anchor.Verify([]byte("other data")) {
+		t.Fatal("anchor is verified for other data")
+	}
+
+	// The ID is kept, so only a recomputed hash shows the transaction changed
+	forged := *anchor.Tx
+	forged.Vout = append([]TXOutput{}, forged.Vout...)
+	forged.Vout[len(forged.Vout)-1].Value++
+	if (&Anchor{anchor.Block, &forged, anchor.Output, anchor.Proof}).Verify(data) {
+		t.Fatal("anchor with a changed transaction is verified")
+	}
+
+	other := (anchor.Output + 1) % len(anchor.Tx.Vout)
+	if (&Anchor{anchor.Block, anchor.Tx, other, anchor.Proof}).Verify(data) {
+		t.Fatal("anchor of an output without the data is verified")
+	}
+}
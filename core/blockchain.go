@@ -2,14 +2,15 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/boltdb/bolt"
-	"github.com/btcsuite/btcutil/base58"
 	"github.com/go-playground/validator"
 	"log"
 	"os"
@@ -18,17 +19,50 @@ import (
 	"time"
 )
 
+// Block is a header with the transactions its merkle root commits to.
+// Hash is the hash of the header
 type Block struct {
-	TimeStamp    int32          `validate:"required"`
+	BlockHeader
 	Hash         []byte         `validate:"required"`
-	PrevHash     []byte         `validate:"required"`
 	Transactions []*Transaction `validate:"required"`
-	Nonce        int            `validate:"min=0"`
+
+	// Signer and Signature seal blocks of proof of authority chains.
+	// They are not hashed, as the signature is made over the block hash
+	Signer    []byte
+	Signature []byte
+}
+
+// MarshalJSON encodes a block with hex hashes
+func (b Block) MarshalJSON() ([]byte, error) {
+	mapStringAny := map[string]any{
+		"Version":      b.Version,
+		"Height":       b.Height,
+		"TimeStamp":    b.TimeStamp,
+		"Hash":         hex.EncodeToString(b.Hash),
+		"PrevHash":     hex.EncodeToString(b.PrevHash),
+		"MerkleRoot":   hex.EncodeToString(b.MerkleRoot),
+		"Bits":         fmt.Sprintf("%08x", b.Bits),
+		"Nonce":        b.Nonce,
+		"Transactions": b.Transactions,
+	}
+	if b.Signer != nil {
+		mapStringAny["Signer"] = hex.EncodeToString(b.Signer)
+		mapStringAny["Signature"] = hex.EncodeToString(b.Signature)
+	}
+	return json.Marshal(mapStringAny)
 }
 
 type Blockchain struct {
-	Db   *bolt.DB
-	last []byte
+	Db     *bolt.DB
+	last   []byte
+	config *Config
+	params *ChainParams
+	engine ConsensusEngine
+
+	// mu serializes changes of the main chain. tipMu guards last,
+	// so the last block can be read while the main chain changes
+	mu    sync.Mutex
+	tipMu sync.RWMutex
 }
 
 type BlockchainIterator struct {
@@ -39,76 +73,159 @@ type BlockchainIterator struct {
 var bc *Blockchain
 var once sync.Once
 var errNotValid = errors.New("can't add this Block")
+var errNoUTXOSet = errors.New("UTXO set is not built")
+
+var (
+	ErrNoBlockchain     = errors.New("there's no blockchain yet, create one first")
+	ErrBlockchainExists = errors.New("blockchain already exists")
+	ErrBlockNotFound    = errors.New("block is not found")
+	ErrBlockchainInUse  = errors.New("blockchain file is in use by another process such as a running node")
+	ErrStaleTip         = errors.New("last block changed while mining")
+)
 
 const InitialNonce = uint64(0)
 
-// subsidy is inflation of new coin
-const subsidy = 10
-
-const dbFile = "dukechain_%s.db"
+// dbTimeout is how long opening the blockchain file waits for another process to close it
+const dbTimeout = time.Second
 
 // validateStructure validates Block struct
 func (bc *Blockchain) validateStructure(newBlock Block) error {
-	fmt.Println(newBlock)
 	validate := validator.New()
 
 	err := validate.Struct(newBlock)
 	if err != nil {
-		for _, err := range err.(validator.ValidationErrors) {
-			fmt.Println(err)
-		}
-		return errNotValid
+		return fmt.Errorf("%w: %v", errNotValid, err)
 	}
 	return nil
 }
 
-// AddBlock gets last block using view function, adds to blocks bucket
-// and updates last bucket
-func (bc *Blockchain) AddBlock(transactions []*Transaction) {
-	var lastHash []byte
+// AddBlock validates transactions, mines them into a new block,
+// adds it to blocks bucket and updates last bucket
+func (bc *Blockchain) AddBlock(transactions []*Transaction) (*Block, error) {
+	return bc.AddBlockContext(context.Background(), transactions, nil)
+}
+
+// AddBlockContext is AddBlock which stops mining when ctx is done and reports hash rate to report.
+// If another block becomes the last block while mining, the mined block is dropped with ErrStaleTip
+func (bc *Blockchain) AddBlockContext(ctx context.Context, transactions []*Transaction, report HashRateFunc) (*Block, error) {
+	var lastBlock *Block
 
 	err := bc.Db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("blocks"))
-		lastHash = b.Get([]byte("last"))
+		lastHash := b.Get([]byte("last"))
 
-		return nil
+		var err error
+		lastBlock, err = DeserializeBlock(b.Get(lastHash))
+		return err
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	newBlock := NewBlock(transactions, lastHash)
+	err = bc.validateTransactions(transactions, lastBlock.Height+1)
+	if err != nil {
+		return nil, err
+	}
+
+	bits, err := bc.engine.NextDifficulty(&lastBlock.BlockHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	timeStamp, err := bc.nextTimeStamp(&lastBlock.BlockHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	newBlock, err := NewBlock(ctx, bc.engine, transactions, lastBlock.Hash, lastBlock.Height+1, bits, timeStamp, report)
+	if err != nil {
+		return nil, err
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if !bytes.Equal(bc.tip(), lastBlock.Hash) {
+		return nil, ErrStaleTip
+	}
 
 	err = bc.Db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("blocks"))
 		err := b.Put(newBlock.Hash, newBlock.Serialize())
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 
-		err = b.Put([]byte("last"), newBlock.Hash)
+		parent, err := getIndexEntry(tx, lastBlock.Hash)
 		if err != nil {
-			log.Panic(err)
+			return err
+		}
+		err = putIndexEntry(tx, newIndexEntry(parent, newBlock))
+		if err != nil {
+			return err
 		}
 
-		bc.last = newBlock.Hash
+		return connectBlock(tx, newBlock)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		fmt.Println("Successfully Added")
+	bc.setTip(newBlock.Hash)
 
-		return nil
-	})
+	return newBlock, nil
+}
+
+// GetBestHeight returns the height of the last block
+func (bc *Blockchain) GetBestHeight() (int, error) {
+	entry, err := bc.indexEntry(bc.tip())
 	if err != nil {
-		log.Panic(err)
+		return 0, err
 	}
+
+	return entry.Height, nil
 }
 
-func dbExists() bool {
-	dbFile := fmt.Sprintf(dbFile, "0600")
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
-		return false
+// GetBlock finds a block by its hash
+func (bc *Blockchain) GetBlock(blockHash []byte) (Block, error) {
+	var block Block
+
+	err := bc.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("blocks"))
+		blockData := b.Get(blockHash)
+		if blockData == nil {
+			return ErrBlockNotFound
+		}
+
+		decoded, err := DeserializeBlock(blockData)
+		if err != nil {
+			return err
+		}
+		block = *decoded
+
+		return nil
+	})
+
+	return block, err
+}
+
+// GetBlockHashes returns hashes of all blocks from the last one to genesis
+func (bc *Blockchain) GetBlockHashes() ([][]byte, error) {
+	var blocks [][]byte
+	bcI := bc.Iterator()
+
+	for {
+		block, err := bcI.GetNextBlock()
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block.Hash)
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
 	}
 
-	return true
+	return blocks, nil
 }
 
 // GetBlockchain opens BoltDB which is written in file, with mode 0600
@@ -116,53 +233,118 @@ func dbExists() bool {
 // to start read-only transaction, you can use DB.View()
 // Bucket is key/value collection in BoltDB
 // every key needs to be unique
-func GetBlockchain() *Blockchain {
-	if !dbExists() {
-		fmt.Println("There's no blockchain yet. Create one first.")
-		os.Exit(1)
+func GetBlockchain(config *Config) (*Blockchain, error) {
+	params, err := config.Params()
+	if err != nil {
+		return nil, err
+	}
+	dbFile, err := config.dbPath()
+	if err != nil {
+		return nil, err
+	}
+	if !fileExists(dbFile) {
+		err = config.checkLegacyDB()
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrNoBlockchain
 	}
-	var last []byte
 
-	dbFile := fmt.Sprintf(dbFile, "0600")
-	db, err := bolt.Open(dbFile, 0600, nil)
+	db, err := openDB(dbFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		bc := tx.Bucket([]byte("blocks"))
-		last = bc.Get([]byte("last"))
+	bc := Blockchain{Db: db, config: config, params: params}
+	err = bc.open()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
-		return nil
+	return &bc, nil
+}
+
+// open reads the last block and builds buckets missing in blockchains
+// created by older versions
+func (bc *Blockchain) open() error {
+	err := bc.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("blocks"))
+		if b == nil {
+			return ErrNoBlockchain
+		}
+		// Values from bolt are only valid during the transaction
+		bc.setTip(append([]byte{}, b.Get([]byte("last"))...))
+
+		_, err := tx.CreateBucketIfNotExists([]byte(undoBucket))
+		return err
 	})
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	err = bc.loadEngine()
+	if err != nil {
+		return err
+	}
+
+	err = ensureBlockIndex(bc.Db, bc.tip())
+	if err != nil {
+		return err
+	}
+
+	err = ensureHeightIndex(bc.Db, bc.tip())
+	if err != nil {
+		return err
+	}
+
+	// Blockchains created before the UTXO set existed get it built once
+	err = bc.Db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(utxoBucket)) == nil {
+			return errNoUTXOSet
+		}
+		return nil
+	})
+	if err == errNoUTXOSet {
+		return UTXOSet{Blockchain: bc}.Build()
 	}
 
-	bc := Blockchain{db, last}
-	return &bc
+	return err
+}
+
+// openDB opens a blockchain file. Only one process can have it open at a time
+func openDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: dbTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s: %w", path, ErrBlockchainInUse)
+	}
+
+	return db, err
 }
 
 // ShowBlocks shows blockData in Block
-func (bc Blockchain) ShowBlocks() {
+func (bc *Blockchain) ShowBlocks() error {
 	bcT := bc.Iterator()
 
 	for {
-		block := bcT.GetNextBlock()
-		pow := NewProofOfWork(block)
-
+		block, err := bcT.GetNextBlock()
+		if err != nil {
+			return err
+		}
 		fmt.Printf("TimeStamp: %d\n", block.TimeStamp)
-		fmt.Printf("Transaction: %s\n", block.Transactions)
+		fmt.Printf("Transaction: %v\n", block.Transactions)
 		fmt.Printf("Hash: %x\n", block.Hash)
 		fmt.Printf("Prev Hash: %x\n", block.PrevHash)
 		fmt.Printf("Nonce: %d\n", block.Nonce)
 
-		fmt.Printf("is Validated: %s\n", strconv.FormatBool(pow.Validate()))
+		fmt.Printf("is Validated: %s\n", strconv.FormatBool(bc.engine.VerifySeal(block) == nil))
 
 		if len(block.PrevHash) == 0 {
 			break
 		}
 	}
+
+	return nil
 }
 
 // Serialize serializes blockData before sending
@@ -172,62 +354,122 @@ func (b *Block) Serialize() []byte {
 	encoder := gob.NewEncoder(&value)
 	err := encoder.Encode(b)
 	if err != nil {
-		log.Fatal("Encode Error: ", err)
+		log.Panic("Encode Error: ", err)
 	}
 
 	return value.Bytes()
 }
 
 // DeserializeBlock deserializes bytes data into block
-func DeserializeBlock(d []byte) *Block {
+func DeserializeBlock(d []byte) (*Block, error) {
 	var block Block
 
 	decoder := gob.NewDecoder(bytes.NewReader(d))
 	err := decoder.Decode(&block)
 	if err != nil {
-		log.Fatal("Decode Error: ", err)
+		return nil, fmt.Errorf("decode block: %w", err)
 	}
 
-	return &block
+	return &block, nil
+}
+
+// Config returns the configuration the blockchain was opened with
+func (bc *Blockchain) Config() *Config {
+	return bc.config
+}
+
+// Params returns the parameters of the network the blockchain belongs to
+func (bc *Blockchain) Params() *ChainParams {
+	return bc.params
+}
+
+// tip returns the hash of the last block
+func (bc *Blockchain) tip() []byte {
+	bc.tipMu.RLock()
+	defer bc.tipMu.RUnlock()
+
+	return bc.last
+}
+
+// setTip makes hash the last block. Callers hold mu
+func (bc *Blockchain) setTip(hash []byte) {
+	bc.tipMu.Lock()
+	defer bc.tipMu.Unlock()
+
+	bc.last = hash
 }
 
 func (bc *Blockchain) Iterator() *BlockchainIterator {
-	bcT := &BlockchainIterator{bc.Db, bc.last}
+	bcT := &BlockchainIterator{bc.Db, bc.tip()}
 
 	return bcT
 }
 
-// NewBlock prepares new block
-func NewBlock(transactions []*Transaction, prevHash []byte) *Block {
-	newblock := &Block{int32(time.Now().Unix()), nil, prevHash, transactions, 0}
-	pow := NewProofOfWork(newblock)
-	nonce, hash := pow.Run()
+// NewBlock prepares new block with difficulty bits and timeStamp sealed by engine
+func NewBlock(ctx context.Context, engine ConsensusEngine, transactions []*Transaction, prevHash []byte, height int, bits uint32, timeStamp int32, report HashRateFunc) (*Block, error) {
+	newblock := &Block{
+		BlockHeader: BlockHeader{
+			Version:   BlockVersion,
+			PrevHash:  prevHash,
+			TimeStamp: timeStamp,
+			Bits:      bits,
+			Height:    height,
+		},
+		Transactions: transactions,
+	}
+	newblock.MerkleRoot = newblock.HashTransactions()
+	err := engine.Seal(ctx, newblock, report)
+	if err != nil {
+		return nil, err
+	}
 
-	newblock.Hash = hash[:]
-	newblock.Nonce = nonce
-	return newblock
+	return newblock, nil
 }
 
-func (bct *BlockchainIterator) GetNextBlock() *Block {
+// GetNextBlock returns the current block and moves to its parent
+func (bct *BlockchainIterator) GetNextBlock() (*Block, error) {
 	var block *Block
 
 	err := bct.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("blocks"))
 		encodedBlock := b.Get(bct.currentHash)
-		block = DeserializeBlock(encodedBlock)
+		if encodedBlock == nil {
+			return ErrBlockNotFound
+		}
 
-		return nil
+		var err error
+		block, err = DeserializeBlock(encodedBlock)
+		return err
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
 	bct.currentHash = block.PrevHash
-	return block
+	return block, nil
 }
 
-func generateGenesis(tx *Transaction) *Block {
-	return NewBlock([]*Transaction{tx}, []byte{})
+// GenesisBlock returns the first block of the network, which is the same on every node.
+// Nobody mined it, so its subsidy goes to an output nobody can spend
+func (p *ChainParams) GenesisBlock() *Block {
+	txin := TXInput{[]byte{}, -1, pushData(nil, []byte(p.GenesisMessage)), 0}
+	txout := TXOutput{p.BlockSubsidy(0), []byte{opReturn}}
+	cb := Transaction{nil, []TXInput{txin}, []TXOutput{txout}, 0}
+	cb.SetID()
+
+	genesis := &Block{
+		BlockHeader: BlockHeader{
+			Version:   BlockVersion,
+			TimeStamp: p.GenesisTime,
+			Bits:      BigToCompact(p.PowLimit()),
+			Nonce:     p.GenesisNonce,
+		},
+		Transactions: []*Transaction{&cb},
+	}
+	genesis.MerkleRoot = genesis.HashTransactions()
+	genesis.Hash = genesis.BlockHeader.Hash()
+
+	return genesis
 }
 
 // GetHash hashes Transaction and returns the hash
@@ -239,7 +481,7 @@ func (tx *Transaction) GetHash() []byte {
 
 	err := enc.Encode(tx)
 	if err != nil {
-		log.Fatal(err)
+		log.Panic(err)
 	}
 
 	hash = sha256.Sum256(writer.Bytes())
@@ -248,13 +490,16 @@ func (tx *Transaction) GetHash() []byte {
 }
 
 // FindUnspentTxs returns a list of transactions containing unspent outputs
-func (bc *Blockchain) FindUnspentTxs(publicKeyHash []byte) []*Transaction {
+func (bc *Blockchain) FindUnspentTxs(publicKeyHash []byte) ([]*Transaction, error) {
 	var unspentTXs []*Transaction
 	spentTXOs := make(map[string][]int)
 	bcI := bc.Iterator()
 
 	for {
-		block := bcI.getNextBlock()
+		block, err := bcI.GetNextBlock()
+		if err != nil {
+			return nil, err
+		}
 
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.ID)
@@ -289,13 +534,16 @@ func (bc *Blockchain) FindUnspentTxs(publicKeyHash []byte) []*Transaction {
 			break
 		}
 	}
-	return unspentTXs
+	return unspentTXs, nil
 }
 
 // FindUTXOs finds and returns unspent transaction outputs for the address
-func (bc *Blockchain) FindUTXOs(publicKeyHash []byte, amount int) (int, map[string][]int) {
+func (bc *Blockchain) FindUTXOs(publicKeyHash []byte, amount int) (int, map[string][]int, error) {
 	unspentOutputs := make(map[string][]int)
-	unspentTXs := bc.FindUnspentTxs(publicKeyHash)
+	unspentTXs, err := bc.FindUnspentTxs(publicKeyHash)
+	if err != nil {
+		return 0, nil, err
+	}
 	accumulated := 0
 
 Work:
@@ -313,84 +561,84 @@ Work:
 		}
 	}
 
-	return accumulated, unspentOutputs
-}
-
-func (bcI *BlockchainIterator) getNextBlock() *Block {
-	var block *Block
-
-	err := bcI.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("blocks"))
-		encodedBlock := b.Get(bcI.currentHash)
-		block = DeserializeBlock(encodedBlock)
-
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
-	}
-
-	bcI.currentHash = block.PrevHash
-	return block
+	return accumulated, unspentOutputs, nil
 }
 
 // GetTransaction gets transaction
 func (bc *Blockchain) GetTransaction(id []byte) (Transaction, error) {
-	bcI := bc.Iterator()
-	for {
-		block := bcI.getNextBlock()
-		for _, tx := range block.Transactions {
-			if bytes.Equal(tx.ID, id) {
-				return *tx, nil
-			}
-		}
-		if len(block.PrevHash) == 0 {
-			break
-		}
+	tx, _, err := bc.FindTransaction(id)
+	if err != nil {
+		return Transaction{}, err
 	}
-	return Transaction{}, errors.New("Transaction not found")
+
+	return *tx, nil
 }
 
 // SignTransaction signs inputs of a Transaction
-func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
+func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) error {
 	prevTXs := make(map[string]Transaction)
 
 	for _, vin := range tx.Vin {
 		prevTX, err := bc.GetTransaction(vin.Txid)
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	tx.Sign(privKey, prevTXs)
+	return tx.Sign(privKey, prevTXs)
 }
 
-func isValidWallet(address string) bool {
-	_, _, err := base58.CheckDecode(address)
+// VerifyTransaction runs input scripts of a Transaction as if it went into the next block
+func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+
+	prevTXs := make(map[string]Transaction)
 
-	return err == nil
+	for _, vin := range tx.Vin {
+		prevTX, err := bc.GetTransaction(vin.Txid)
+		if err != nil {
+			return false
+		}
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	}
+
+	return tx.Verify(prevTXs) == nil
 }
 
-func CreateBlockchain(address string) *Blockchain {
-	if dbExists() {
-		fmt.Println("Blockchain already exists.")
-		os.Exit(1)
+// CreateBlockchain creates a blockchain file holding the genesis block of the network.
+// If authorities are given, blocks after genesis are signed by them in turn instead of mined
+func CreateBlockchain(authorities []string, config *Config) (*Blockchain, error) {
+	params, err := config.Params()
+	if err != nil {
+		return nil, err
 	}
-	if !isValidWallet(address) {
-		fmt.Println("Use correct wallet")
-		os.Exit(1)
+	dbFile, err := config.dbPath()
+	if err != nil {
+		return nil, err
 	}
+	if fileExists(dbFile) {
+		return nil, ErrBlockchainExists
+	}
+	var authorityKeys [][]byte
+	for _, authority := range authorities {
+		pubKeyHash, err := params.DecodeAddress(authority)
+		if err != nil {
+			return nil, err
+		}
+		authorityKeys = append(authorityKeys, pubKeyHash)
+	}
+	genesis := params.GenesisBlock()
+
 	var last []byte
-	dbFile := fmt.Sprintf(dbFile, "0600")
-	db, err := bolt.Open(dbFile, 0600, nil)
+	db, err := openDB(dbFile)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
 	err = db.Update(func(tx *bolt.Tx) error {
-		cb := NewCoinbaseTX(address, "init base")
-		genesis := generateGenesis(cb)
 		b, err := tx.CreateBucket([]byte("blocks"))
 		if err != nil {
 			return err
@@ -403,31 +651,79 @@ func CreateBlockchain(address string) *Blockchain {
 		if err != nil {
 			return err
 		}
+		_, err = tx.CreateBucket([]byte(blockIndexBucket))
+		if err != nil {
+			return err
+		}
+		err = putIndexEntry(tx, newIndexEntry(nil, genesis))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket([]byte(utxoBucket))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket([]byte(undoBucket))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket([]byte(heightIndexBucket))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket([]byte(txIndexBucket))
+		if err != nil {
+			return err
+		}
+		if len(authorityKeys) > 0 {
+			err = putAuthorities(tx, authorityKeys)
+			if err != nil {
+				return err
+			}
+		}
+		err = connectBlock(tx, genesis)
+		if err != nil {
+			return err
+		}
 		last = genesis.Hash
 		return nil
 	})
 	if err != nil {
-		log.Fatal(err)
+		db.Close()
+		os.Remove(dbFile)
+		return nil, err
+	}
+
+	bc := Blockchain{Db: db, last: last, config: config, params: params}
+	err = bc.loadEngine()
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	bc := Blockchain{db, last}
-	return &bc
+	return &bc, nil
 }
 
 // FindAllUTXOs finds all unspent transaction outputs
-func (bc *Blockchain) FindAllUTXOs() map[string][]TXOutput {
-	UTXO := make(map[string][]TXOutput)
+func (bc *Blockchain) FindAllUTXOs() (map[string]TXOutputs, error) {
+	UTXO := make(map[string]TXOutputs)
 	spentTXOs := make(map[string][]int)
 	bcI := bc.Iterator()
 
 	for {
-		block := bcI.getNextBlock()
+		block, err := bcI.GetNextBlock()
+		if err != nil {
+			return nil, err
+		}
 
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.ID)
 
 		Outputs:
 			for outIndex, out := range tx.Vout {
+				if isUnspendable(out.ScriptPubKey) {
+					continue
+				}
 				if spentTXOs[txID] != nil {
 					for _, spentOut := range spentTXOs[txID] {
 						if spentOut == outIndex {
@@ -435,7 +731,12 @@ func (bc *Blockchain) FindAllUTXOs() map[string][]TXOutput {
 						}
 					}
 				}
-				UTXO[txID] = append(UTXO[txID], out)
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = TXOutputs{make(map[int]TXOutput), tx.IsCoinbase(), block.Height}
+					UTXO[txID] = outs
+				}
+				outs.Outputs[outIndex] = out
 			}
 
 			if !tx.IsCoinbase() {
@@ -451,5 +752,5 @@ func (bc *Blockchain) FindAllUTXOs() map[string][]TXOutput {
 		}
 	}
 
-	return UTXO
+	return UTXO, nil
 }
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// newTestChain creates a regtest blockchain in a temporary directory
+// and returns it with the address of a new wallet
+func newTestChain(t *testing.T) (*Blockchain, string) {
+	t.Helper()
+
+	config := &Config{DataDir: t.TempDir(), Network: RegTest}
+	address := newTestAddress(t, config)
+
+	bc, err := CreateBlockchain(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Db.Close() })
+
+	return bc, address
+}
+
+// newTestAddress adds a wallet to the wallet file of config and returns its address
+func newTestAddress(t *testing.T, config *Config) string {
+	t.Helper()
+
+	wallets, err := NewWallets(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return address
+}
+
+// mineBlocks mines n blocks with the transactions of mp and pays their rewards to address
+func mineBlocks(t *testing.T, bc *Blockchain, address string, mp *Mempool, n int) []*Block {
+	t.Helper()
+
+	var blocks []*Block
+	for i := 0; i < n; i++ {
+		block, err := bc.MineBlock(context.Background(), address, mp, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// newTestBlock seals a block with txs on top of the last block without adding it to the chain
+func newTestBlock(t *testing.T, bc *Blockchain, txs []*Transaction) *Block {
+	t.Helper()
+
+	parent, err := bc.GetBlock(bc.tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestBlockOn(t, bc, &parent, txs)
+}
+
+// newTestBlockOn seals a block with txs on top of parent, which needn't be stored
+func newTestBlockOn(t *testing.T, bc *Blockchain, parent *Block, txs []*Transaction) *Block {
+	t.Helper()
+
+	bits, err := bc.engine.NextDifficulty(&parent.BlockHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeStamp, err := bc.nextTimeStamp(&parent.BlockHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := NewBlock(context.Background(), bc.engine, txs, parent.Hash, parent.Height+1, bits, timeStamp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+// newTestCoinbase creates a coinbase of the next block paying its subsidy to address
+func newTestCoinbase(t *testing.T, bc *Blockchain, address string) *Transaction {
+	t.Helper()
+
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, err := NewCoinbaseTX(address, "Mining reward", bc.params.BlockSubsidy(height+1), bc.params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cb
+}
+
+func TestMineBlock(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+
+	blocks := mineBlocks(t, bc, address, mp, 3)
+
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 3 {
+		t.Fatalf("best height is %d, want 3", height)
+	}
+	if !bytes.Equal(bc.tip(), blocks[2].Hash) {
+		t.Fatalf("last block is %x, want %x", bc.tip(), blocks[2].Hash)
+	}
+}
+
+func TestBlockchainInUse(t *testing.T) {
+	bc, _ := newTestChain(t)
+
+	// A running node keeps the file open, so a command on the same data directory must not wait forever
+	_, err := GetBlockchain(bc.config)
+	if !errors.Is(err, ErrBlockchainInUse) {
+		t.Fatalf("GetBlockchain returned %v, want %v", err, ErrBlockchainInUse)
+	}
+}
+
+func TestGenesisBlock(t *testing.T) {
+	for _, params := range []*ChainParams{&MainNetParams, &TestNetParams, &RegTestParams} {
+		genesis := params.GenesisBlock()
+		if err := (&PoWEngine{}).VerifySeal(genesis); err != nil {
+			t.Errorf("%s genesis: %v", params.Name, err)
+		}
+		if !bytes.Equal(params.GenesisBlock().Hash, genesis.Hash) {
+			t.Errorf("%s genesis changes between calls", params.Name)
+		}
+	}
+
+	first, _ := newTestChain(t)
+	second, _ := newTestChain(t)
+	if !bytes.Equal(first.tip(), second.tip()) {
+		t.Fatalf("chains start with different genesis blocks %x and %x", first.tip(), second.tip())
+	}
+}
+
+func TestReadTipWhileMining(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			if _, err := bc.MineBlock(context.Background(), address, mp, nil); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// Run with -race to see the tip is read safely
+		if _, err := bc.GetBestHeight(); err != nil {
+			t.Fatal(err)
+		}
+		bc.Iterator()
+	}
+}
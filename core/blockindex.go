@@ -0,0 +1,151 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"github.com/boltdb/bolt"
+	"log"
+	"math/big"
+)
+
+const blockIndexBucket = "blockindex"
+
+// blockIndexEntry describes a stored block and the branch it belongs to.
+// Work is the cumulative work from genesis up to and including the block.
+// Header is the serialized header, so headers are read without their transactions
+type blockIndexEntry struct {
+	Hash     []byte
+	PrevHash []byte
+	Height   int
+	Work     []byte
+	Invalid  bool
+	Header   []byte
+}
+
+// blockWork is the expected number of hashes to find a block with bits
+func blockWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	// 2^256 / (target + 1)
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, target.Add(target, big.NewInt(1)))
+}
+
+// newIndexEntry makes an index entry for a block whose parent is described by parent
+func newIndexEntry(parent *blockIndexEntry, block *Block) *blockIndexEntry {
+	work := blockWork(block.Bits)
+	if parent != nil {
+		work.Add(work, parent.work())
+	}
+
+	return &blockIndexEntry{block.Hash, block.PrevHash, block.Height, work.Bytes(), false, block.BlockHeader.Serialize()}
+}
+
+func (e *blockIndexEntry) work() *big.Int {
+	return new(big.Int).SetBytes(e.Work)
+}
+
+func (e *blockIndexEntry) serialize() []byte {
+	var value bytes.Buffer
+
+	encoder := gob.NewEncoder(&value)
+	err := encoder.Encode(e)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return value.Bytes()
+}
+
+func deserializeIndexEntry(d []byte) (*blockIndexEntry, error) {
+	var entry blockIndexEntry
+
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	err := decoder.Decode(&entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func getIndexEntry(tx *bolt.Tx, hash []byte) (*blockIndexEntry, error) {
+	data := tx.Bucket([]byte(blockIndexBucket)).Get(hash)
+	if data == nil {
+		return nil, ErrOrphanBlock
+	}
+
+	return deserializeIndexEntry(data)
+}
+
+func putIndexEntry(tx *bolt.Tx, entry *blockIndexEntry) error {
+	return tx.Bucket([]byte(blockIndexBucket)).Put(entry.Hash, entry.serialize())
+}
+
+// indexEntry returns the index entry of a stored block
+func (bc *Blockchain) indexEntry(hash []byte) (*blockIndexEntry, error) {
+	var entry *blockIndexEntry
+
+	err := bc.Db.View(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = getIndexEntry(tx, hash)
+
+		return err
+	})
+
+	return entry, err
+}
+
+// GetBlockHeader finds the header of a stored block by its hash
+func (bc *Blockchain) GetBlockHeader(hash []byte) (*BlockHeader, error) {
+	entry, err := bc.indexEntry(hash)
+	if errors.Is(err, ErrOrphanBlock) {
+		return nil, ErrBlockNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return DeserializeHeader(entry.Header)
+}
+
+// ensureBlockIndex builds the block index from the main chain
+// for blockchains created before the index existed
+func ensureBlockIndex(db *bolt.DB, last []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(blockIndexBucket)) != nil {
+			return nil
+		}
+		_, err := tx.CreateBucket([]byte(blockIndexBucket))
+		if err != nil {
+			return err
+		}
+
+		var chain []*Block
+		blocks := tx.Bucket([]byte("blocks"))
+		for hash := last; len(hash) > 0; {
+			block, err := DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return err
+			}
+			chain = append(chain, block)
+			hash = block.PrevHash
+		}
+
+		var parent *blockIndexEntry
+		for i := len(chain) - 1; i >= 0; i-- {
+			entry := newIndexEntry(parent, chain[i])
+			err = putIndexEntry(tx, entry)
+			if err != nil {
+				return err
+			}
+			parent = entry
+		}
+
+		return nil
+	})
+}
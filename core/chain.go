@@ -0,0 +1,283 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	ErrOrphanBlock     = errors.New("parent of the block is unknown")
+	ErrInvalidParent   = errors.New("block extends an invalid block")
+	ErrRollbackGenesis = errors.New("genesis block can't be disconnected")
+)
+
+// ChainUpdate lists the blocks a change of the main chain disconnected, from the old last block down,
+// and the blocks it connected, from the lowest one up
+type ChainUpdate struct {
+	Disconnected []*Block
+	Connected    []*Block
+}
+
+// ImportBlock stores a block received from another node in the block index.
+// If its branch has more cumulative work than the main chain, the branch
+// is validated and becomes the main chain. The returned update tells how the main chain changed
+func (bc *Blockchain) ImportBlock(block *Block) (*ChainUpdate, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if _, err := bc.indexEntry(block.Hash); err == nil {
+		return &ChainUpdate{}, nil
+	}
+
+	parent, err := bc.indexEntry(block.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Invalid {
+		return nil, ErrInvalidParent
+	}
+	if block.Height != parent.Height+1 {
+		return nil, ErrBadHeight
+	}
+
+	parentBlock, err := bc.GetBlock(block.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	// A block too far in the future is rejected before it is stored, so it can be received again later
+	err = bc.checkTimestamp(&block.BlockHeader, &parentBlock.BlockHeader)
+	if err != nil {
+		return nil, err
+	}
+	bits, err := bc.engine.NextDifficulty(&parentBlock.BlockHeader)
+	if err != nil {
+		return nil, err
+	}
+	if block.Bits != bits {
+		return nil, ErrBadDifficulty
+	}
+	err = bc.engine.VerifySeal(block)
+	if err != nil {
+		return nil, err
+	}
+	err = block.checkMerkleRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := newIndexEntry(parent, block)
+	err = bc.Db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte("blocks")).Put(block.Hash, block.Serialize())
+		if err != nil {
+			return err
+		}
+
+		return putIndexEntry(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tip, err := bc.indexEntry(bc.tip())
+	if err != nil {
+		return nil, err
+	}
+	if entry.work().Cmp(tip.work()) <= 0 {
+		return &ChainUpdate{}, nil
+	}
+
+	return bc.reorganize(entry)
+}
+
+// reorganize makes newTip the last block. Blocks of the main chain above
+// the fork point are disconnected and blocks of the new branch are validated
+// and connected one by one. If a block of the branch is invalid,
+// the old main chain is restored and the error is returned without an update
+func (bc *Blockchain) reorganize(newTip *blockIndexEntry) (*ChainUpdate, error) {
+	oldTip, err := bc.indexEntry(bc.tip())
+	if err != nil {
+		return nil, err
+	}
+
+	fork, branch, err := bc.findFork(oldTip, newTip)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &ChainUpdate{}
+	for !bytes.Equal(bc.tip(), fork.Hash) {
+		block, err := bc.GetBlock(bc.tip())
+		if err != nil {
+			return nil, err
+		}
+
+		err = bc.Db.Update(func(tx *bolt.Tx) error {
+			return disconnectBlock(tx, &block)
+		})
+		if err != nil {
+			return nil, err
+		}
+		bc.setTip(block.PrevHash)
+		update.Disconnected = append(update.Disconnected, &block)
+	}
+
+	for i, entry := range branch {
+		block, err := bc.GetBlock(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		err = bc.ValidateBlock(&block)
+		if err != nil {
+			// Descendants of an invalid block are invalid too
+			if mErr := bc.markInvalid(branch[i:]); mErr != nil {
+				return nil, mErr
+			}
+
+			if _, rErr := bc.reorganize(oldTip); rErr != nil {
+				return nil, fmt.Errorf("restore main chain after %v: %w", err, rErr)
+			}
+			return nil, err
+		}
+
+		err = bc.Db.Update(func(tx *bolt.Tx) error {
+			return connectBlock(tx, &block)
+		})
+		if err != nil {
+			return nil, err
+		}
+		bc.setTip(block.Hash)
+		update.Connected = append(update.Connected, &block)
+	}
+
+	return update, nil
+}
+
+// findFork returns the last common block of two tips and
+// the blocks of the second tip's branch above it, from the lowest
+func (bc *Blockchain) findFork(a, b *blockIndexEntry) (*blockIndexEntry, []*blockIndexEntry, error) {
+	var branch []*blockIndexEntry
+	var err error
+
+	for a.Height > b.Height {
+		a, err = bc.indexEntry(a.PrevHash)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for b.Height > a.Height {
+		branch = append(branch, b)
+		b, err = bc.indexEntry(b.PrevHash)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for !bytes.Equal(a.Hash, b.Hash) {
+		branch = append(branch, b)
+		a, err = bc.indexEntry(a.PrevHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err = bc.indexEntry(b.PrevHash)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+
+	return a, branch, nil
+}
+
+// Rollback disconnects the last n blocks. Disconnected blocks stay valid in the block index,
+// so the node follows them again once a new block on top of them is received.
+// Receiving a disconnected block itself again changes nothing
+func (bc *Blockchain) Rollback(n int) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	if n > height {
+		return ErrRollbackGenesis
+	}
+
+	for i := 0; i < n; i++ {
+		block, err := bc.GetBlock(bc.tip())
+		if err != nil {
+			return err
+		}
+
+		err = bc.Db.Update(func(tx *bolt.Tx) error {
+			return disconnectBlock(tx, &block)
+		})
+		if err != nil {
+			return err
+		}
+		bc.setTip(block.PrevHash)
+	}
+
+	return nil
+}
+
+func (bc *Blockchain) markInvalid(entries []*blockIndexEntry) error {
+	return bc.Db.Update(func(tx *bolt.Tx) error {
+		for _, entry := range entries {
+			entry.Invalid = true
+			err := putIndexEntry(tx, entry)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// connectBlock makes a stored block the last one, indexes it by height,
+// indexes its transactions and applies it to the UTXO set
+func connectBlock(tx *bolt.Tx, block *Block) error {
+	err := tx.Bucket([]byte("blocks")).Put([]byte("last"), block.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket([]byte(heightIndexBucket)).Put(heightKey(block.Height), block.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = indexTransactions(tx, block)
+	if err != nil {
+		return err
+	}
+
+	return connectOutputs(tx, block)
+}
+
+// disconnectBlock makes the parent of the last block the last one, removes it
+// and its transactions from the indexes and rolls the UTXO set back
+func disconnectBlock(tx *bolt.Tx, block *Block) error {
+	err := tx.Bucket([]byte("blocks")).Put([]byte("last"), block.PrevHash)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket([]byte(heightIndexBucket)).Delete(heightKey(block.Height))
+	if err != nil {
+		return err
+	}
+
+	err = unindexTransactions(tx, block)
+	if err != nil {
+		return err
+	}
+
+	return disconnectOutputs(tx, block)
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+// newTestBranch mines n blocks paying to address on top of the block with parentHash.
+// txs go into the first of them
+func newTestBranch(t *testing.T, bc *Blockchain, parentHash []byte, address string, n int, txs []*Transaction) []*Block {
+	t.Helper()
+
+	stored, err := bc.GetBlock(parentHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := &stored
+
+	var blocks []*Block
+	for i := 0; i < n; i++ {
+		cb, err := NewCoinbaseTX(address, "Mining reward", bc.params.BlockSubsidy(parent.Height+1), bc.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block := newTestBlockOn(t, bc, parent, append([]*Transaction{cb}, txs...))
+		txs = nil
+		blocks = append(blocks, block)
+		parent = block
+	}
+
+	return blocks
+}
+
+func TestReorganizationUpdatesMempool(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+
+	// kept is mined on the old branch, confirmed on the new one
+	spends := newTestSpends(t, bc, address, mp, 2)
+	kept, confirmed := spends[0], spends[1]
+	fork := bc.tip()
+
+	if err := mp.Add(kept); err != nil {
+		t.Fatal(err)
+	}
+	old := mineBlocks(t, bc, address, mp, 1)[0]
+	if mp.Count() != 0 {
+		t.Fatalf("mempool has %d transactions after mining", mp.Count())
+	}
+	if err := mp.Add(confirmed); err != nil {
+		t.Fatal(err)
+	}
+
+	branch := newTestBranch(t, bc, fork, address, 2, []*Transaction{confirmed})
+	update, err := bc.ImportBlock(branch[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Connected)+len(update.Disconnected) != 0 {
+		t.Fatal("block with equal work changed the main chain")
+	}
+	update, err = bc.ImportBlock(branch[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Disconnected) != 1 || !bytes.Equal(update.Disconnected[0].Hash, old.Hash) {
+		t.Fatalf("disconnected %d blocks, want %x", len(update.Disconnected), old.Hash)
+	}
+	if len(update.Connected) != 2 || !bytes.Equal(update.Connected[1].Hash, branch[1].Hash) {
+		t.Fatalf("connected %d blocks, want the branch", len(update.Connected))
+	}
+
+	mp.UpdateChain(update)
+	if mp.Has(confirmed.ID) {
+		t.Fatal("transaction confirmed by the new branch is still in mempool")
+	}
+	if !mp.Has(kept.ID) {
+		t.Fatal("transaction of the disconnected block is not in mempool again")
+	}
+	if mp.Count() != 1 {
+		t.Fatalf("mempool has %d transactions, want 1", mp.Count())
+	}
+}
+func TestRollback(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+	blocks := mineBlocks(t, bc, address, mp, 3)
+
+	if err := bc.Rollback(4); err != ErrRollbackGenesis {
+		t.Fatalf("Rollback past genesis returned %v, want %v", err, ErrRollbackGenesis)
+	}
+	if err := bc.Rollback(2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bc.tip(), blocks[0].Hash) {
+		t.Fatalf("last block is %x, want %x", bc.tip(), blocks[0].Hash)
+	}
+
+	// A disconnected block is known already, so receiving it again is a no-op
+	update, err := bc.ImportBlock(blocks[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Connected) != 0 || !bytes.Equal(bc.tip(), blocks[0].Hash) {
+		t.Fatalf("receiving a disconnected block again moved the last block to %x", bc.tip())
+	}
+
+	// Other nodes keep extending the disconnected blocks, which the node follows again
+	next := newTestBranch(t, bc, blocks[2].Hash, address, 1, nil)[0]
+	update, err = bc.ImportBlock(next)
+	if err != nil {
+		t.Fatalf("ImportBlock on top of disconnected blocks returned %v", err)
+	}
+	if len(update.Connected) != 3 {
+		t.Fatalf("connected %d blocks, want 3", len(update.Connected))
+	}
+	if !bytes.Equal(bc.tip(), next.Hash) {
+		t.Fatalf("last block is %x, want %x", bc.tip(), next.Hash)
+	}
+}
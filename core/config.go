@@ -0,0 +1,145 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the networks a node can follow
+const (
+	MainNet = "mainnet"
+	TestNet = "testnet"
+	RegTest = "regtest"
+)
+
+const (
+	dbFile     = "dukechain.db"
+	walletFile = "wallet.dat"
+)
+
+// Versions before Config kept mainnet files in the working directory.
+// The blockchain file was named after NODE_ID, which was 0600 if not set
+const (
+	legacyDBFile     = "dukechain_%s.db"
+	legacyWalletFile = "gowallet.dat"
+	legacyNodeID     = "0600"
+)
+
+var (
+	ErrUnknownNetwork   = errors.New("unknown network")
+	ErrLegacyBlockchain = errors.New("blockchain file of an older version can't be read, create a new blockchain or use -datadir")
+)
+
+// Config tells where a node keeps its files and which network it follows.
+// Every network gets its own directory under DataDir, so chains of
+// different networks can be used side by side
+type Config struct {
+	DataDir string
+	Network string
+
+	// NodeID, if set, is added to the names of the blockchain and wallet files,
+	// so several nodes can keep their own files in one directory
+	NodeID string
+
+	// LegacyDir, if set, is where mainnet files of versions before Config are looked for.
+	// The legacy wallet file is used as long as the network directory has none.
+	// Blocks have another format now, so the legacy blockchain file is never opened
+	LegacyDir string
+}
+
+// DefaultConfig uses .dukechain in the home directory and mainnet.
+// Files older versions kept in the working directory are still looked for
+func DefaultConfig() *Config {
+	dataDir := ".dukechain"
+	if home, err := os.UserHomeDir(); err == nil {
+		dataDir = filepath.Join(home, dataDir)
+	}
+
+	return &Config{DataDir: dataDir, Network: MainNet, LegacyDir: "."}
+}
+
+// Params returns the parameters of the configured network
+func (c *Config) Params() (*ChainParams, error) {
+	return ParamsForNetwork(c.Network)
+}
+
+// dir returns the directory of the configured network and creates it if needed
+func (c *Config) dir() (string, error) {
+	_, err := c.Params()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(c.DataDir, c.Network)
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+func (c *Config) dbPath() (string, error) {
+	dir, err := c.dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, c.nodeFile(dbFile)), nil
+}
+
+// checkLegacyDB returns ErrLegacyBlockchain if the blockchain file of an older version is where it used to be.
+// It is only looked at, as opening it would add buckets to it
+func (c *Config) checkLegacyDB() error {
+	if c.LegacyDir == "" || c.Network != MainNet {
+		return nil
+	}
+
+	nodeID := c.NodeID
+	if nodeID == "" {
+		nodeID = legacyNodeID
+	}
+	legacyPath := filepath.Join(c.LegacyDir, fmt.Sprintf(legacyDBFile, nodeID))
+	if fileExists(legacyPath) {
+		return fmt.Errorf("%s: %w", legacyPath, ErrLegacyBlockchain)
+	}
+
+	return nil
+}
+
+func (c *Config) walletPath() (string, error) {
+	return c.filePath(c.nodeFile(walletFile), legacyWalletFile)
+}
+
+// nodeFile adds NodeID to a file name, e.g. dukechain_3000.db
+func (c *Config) nodeFile(name string) string {
+	if c.NodeID == "" {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "_" + c.NodeID + ext
+}
+
+// filePath returns the path of a file in the network directory
+// or of the legacy file, if only the legacy one exists
+func (c *Config) filePath(name, legacy string) (string, error) {
+	dir, err := c.dir()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, name)
+	if c.LegacyDir != "" && c.Network == MainNet && !fileExists(path) {
+		legacyPath := filepath.Join(c.LegacyDir, legacy)
+		if fileExists(legacyPath) {
+			return legacyPath, nil
+		}
+	}
+
+	return path, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+
+	return !os.IsNotExist(err)
+}
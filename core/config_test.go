@@ -0,0 +1,130 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigPaths(t *testing.T) {
+	dataDir := t.TempDir()
+	legacyDir := t.TempDir()
+
+	tests := []struct {
+		name                     string
+		config                   Config
+		legacyFiles              []string
+		wantDB, wantWallet       string
+		createdDB, createdWallet bool
+	}{
+		{
+			name:       "default",
+			config:     Config{DataDir: dataDir, Network: MainNet, LegacyDir: legacyDir},
+			wantDB:     filepath.Join(dataDir, MainNet, "dukechain.db"),
+			wantWallet: filepath.Join(dataDir, MainNet, "wallet.dat"),
+		},
+		{
+			name:       "node ID",
+			config:     Config{DataDir: dataDir, Network: RegTest, NodeID: "3001"},
+			wantDB:     filepath.Join(dataDir, RegTest, "dukechain_3001.db"),
+			wantWallet: filepath.Join(dataDir, RegTest, "wallet_3001.dat"),
+		},
+		{
+			name:        "legacy files",
+			config:      Config{DataDir: dataDir, Network: MainNet, LegacyDir: legacyDir},
+			legacyFiles: []string{"dukechain_0600.db", "gowallet.dat"},
+			wantDB:      filepath.Join(dataDir, MainNet, "dukechain.db"),
+			wantWallet:  filepath.Join(legacyDir, "gowallet.dat"),
+		},
+		{
+			name:        "legacy files of another network",
+			config:      Config{DataDir: dataDir, Network: TestNet, LegacyDir: legacyDir},
+			legacyFiles: []string{"dukechain_0600.db", "gowallet.dat"},
+			wantDB:      filepath.Join(dataDir, TestNet, "dukechain.db"),
+			wantWallet:  filepath.Join(dataDir, TestNet, "wallet.dat"),
+		},
+		{
+			name:          "files in data directory win",
+			config:        Config{DataDir: dataDir, Network: MainNet, LegacyDir: legacyDir},
+			legacyFiles:   []string{"dukechain_0600.db", "gowallet.dat"},
+			wantDB:        filepath.Join(dataDir, MainNet, "dukechain.db"),
+			wantWallet:    filepath.Join(dataDir, MainNet, "wallet.dat"),
+			createdDB:     true,
+			createdWallet: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, dir := range []string{legacyDir, filepath.Join(dataDir, MainNet)} {
+				os.RemoveAll(dir)
+				if err := os.MkdirAll(dir, 0700); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range tt.legacyFiles {
+				if err := os.WriteFile(filepath.Join(legacyDir, name), nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.createdDB {
+				os.WriteFile(tt.wantDB, nil, 0600)
+			}
+			if tt.createdWallet {
+				os.WriteFile(tt.wantWallet, nil, 0600)
+			}
+
+			db, err := tt.config.dbPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if db != tt.wantDB {
+				t.Errorf("blockchain file is %s, want %s", db, tt.wantDB)
+			}
+			wallet, err := tt.config.walletPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wallet != tt.wantWallet {
+				t.Errorf("wallet file is %s, want %s", wallet, tt.wantWallet)
+			}
+		})
+	}
+}
+
+func TestLegacyBlockchainIsNotOpened(t *testing.T) {
+	legacyDir := t.TempDir()
+	config := &Config{DataDir: t.TempDir(), Network: MainNet, LegacyDir: legacyDir}
+
+	legacyPath := filepath.Join(legacyDir, "dukechain_0600.db")
+	content := []byte("blockchain file of an older version")
+	err := os.WriteFile(legacyPath, content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = GetBlockchain(config)
+	if !errors.Is(err, ErrLegacyBlockchain) {
+		t.Fatalf("GetBlockchain returned %v, want %v", err, ErrLegacyBlockchain)
+	}
+	got, err := os.ReadFile(legacyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("legacy blockchain file is changed")
+	}
+
+	// A new blockchain goes to the data directory and is used from then on
+	bc, err := CreateBlockchain(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Db.Close()
+	bc, err = GetBlockchain(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Db.Close()
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"github.com/boltdb/bolt"
+	"log"
+)
+
+const consensusBucket = "consensus"
+const authoritiesKey = "authorities"
+
+var (
+	ErrNotInTurn     = errors.New("signing key is not of the authority in turn")
+	ErrNotAuthority  = errors.New("address is not an authority of the chain")
+	ErrNoSigningKey  = errors.New("no signing key of an authority is set")
+	ErrInvalidSeal   = errors.New("block is not signed by the authority in turn")
+	ErrNoAuthorities = errors.New("proof of authority needs at least one authority")
+)
+
+// ConsensusEngine decides who may create blocks and how blocks prove it.
+// Blockchain seals and verifies every block with its engine
+type ConsensusEngine interface {
+	// Seal completes a block by setting its hash and the proof the engine requires.
+	// Sealing stops when ctx is done and report gets the hash rate meanwhile, if the engine hashes
+	Seal(ctx context.Context, block *Block, report HashRateFunc) error
+	// VerifySeal checks the hash and the proof of a block
+	VerifySeal(block *Block) error
+	// NextDifficulty returns the bits a block on top of parent must have
+	NextDifficulty(parent *BlockHeader) (uint32, error)
+}
+
+// PoWEngine seals blocks with SHA-256 proof of work at the difficulty of the chain
+type PoWEngine struct {
+	bc *Blockchain
+}
+
+// Seal searches a nonce whose block hash meets the target of the block bits
+func (e *PoWEngine) Seal(ctx context.Context, block *Block, report HashRateFunc) error {
+	nonce, hash, err := NewProofOfWork(&block.BlockHeader).Run(ctx, report)
+	if err != nil {
+		return err
+	}
+
+	block.Hash = hash
+	block.Nonce = nonce
+	return nil
+}
+
+// VerifySeal checks the block hash meets the target of the block bits
+func (e *PoWEngine) VerifySeal(block *Block) error {
+	if !NewProofOfWork(&block.BlockHeader).Validate() || !bytes.Equal(block.BlockHeader.Hash(), block.Hash) {
+		return ErrInvalidProofOfWork
+	}
+
+	return nil
+}
+
+// NextDifficulty retargets the difficulty as the chain parameters say
+func (e *PoWEngine) NextDifficulty(parent *BlockHeader) (uint32, error) {
+	return e.bc.nextBits(parent)
+}
+
+// PoAEngine lets a fixed set of authorities sign blocks in turn:
+// the block at height h is signed by authority h modulo the number of authorities.
+// Authorities are public key hashes, so they are given as addresses
+type PoAEngine struct {
+	authorities [][]byte
+	signer      *Wallet
+}
+
+// NewPoAEngine creates a proof of authority engine with the public key hashes of authorities
+func NewPoAEngine(authorities [][]byte) (*PoAEngine, error) {
+	if len(authorities) == 0 {
+		return nil, ErrNoAuthorities
+	}
+
+	return &PoAEngine{authorities: authorities}, nil
+}
+
+// SetSigner sets the wallet of an authority to sign blocks with
+func (e *PoAEngine) SetSigner(w *Wallet) error {
+	pubKeyHash := HashPublicKey(w.PublicKey)
+	for _, authority := range e.authorities {
+		if bytes.Equal(authority, pubKeyHash) {
+			e.signer = w
+			return nil
+		}
+	}
+
+	return ErrNotAuthority
+}
+
+// Authorities returns public key hashes of the authorities in their signing order
+func (e *PoAEngine) Authorities() [][]byte {
+	return e.authorities
+}
+
+// inTurn returns the public key hash of the authority which signs the block at height
+func (e *PoAEngine) inTurn(height int) []byte {
+	return e.authorities[height%len(e.authorities)]
+}
+
+// Seal signs the block hash with the signer if it is in turn at the block height
+func (e *PoAEngine) Seal(ctx context.Context, block *Block, report HashRateFunc) error {
+	if e.signer == nil {
+		return ErrNoSigningKey
+	}
+	if !bytes.Equal(HashPublicKey(e.signer.PublicKey), e.inTurn(block.Height)) {
+		return ErrNotInTurn
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	block.Nonce = 0
+	block.Hash = block.BlockHeader.Hash()
+	signature, err := signHash(&e.signer.PrivateKey, block.Hash)
+	if err != nil {
+		return err
+	}
+	block.Signer = e.signer.PublicKey
+	block.Signature = signature
+
+	return nil
+}
+
+// VerifySeal checks the block is signed by the authority in turn at its height.
+// Signatures have the fixed size and low S of signHash, so a block can't be relayed with another one
+// Genesis is mined before the authorities sign blocks, so it keeps its proof of work
+func (e *PoAEngine) VerifySeal(block *Block) error {
+	if block.Height == 0 {
+		return (&PoWEngine{}).VerifySeal(block)
+	}
+
+	if !bytes.Equal(HashPublicKey(block.Signer), e.inTurn(block.Height)) ||
+		!bytes.Equal(block.BlockHeader.Hash(), block.Hash) {
+		return ErrInvalidSeal
+	}
+
+	pubKey, err := parsePublicKey(block.Signer)
+	if err != nil {
+		return ErrInvalidSeal
+	}
+	if !verifySignature(pubKey, block.Hash, block.Signature) {
+		return ErrInvalidSeal
+	}
+
+	return nil
+}
+
+// NextDifficulty keeps the bits of genesis, as signing needs no work.
+// Every block then adds the same work and the longest chain wins
+func (e *PoAEngine) NextDifficulty(parent *BlockHeader) (uint32, error) {
+	return parent.Bits, nil
+}
+
+// Engine returns the consensus engine the blockchain was created with
+func (bc *Blockchain) Engine() ConsensusEngine {
+	return bc.engine
+}
+
+// loadEngine creates proof of authority engine if the blockchain was created with authorities
+// and proof of work engine otherwise
+func (bc *Blockchain) loadEngine() error {
+	var authorities [][]byte
+
+	err := bc.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(consensusBucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(authoritiesKey))
+		if data == nil {
+			return nil
+		}
+
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(&authorities)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(authorities) == 0 {
+		bc.engine = &PoWEngine{bc}
+		return nil
+	}
+
+	bc.engine, err = NewPoAEngine(authorities)
+	return err
+}
+
+// putAuthorities stores public key hashes of the authorities of a proof of authority chain
+func putAuthorities(tx *bolt.Tx, authorities [][]byte) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(consensusBucket))
+	if err != nil {
+		return err
+	}
+
+	var buff bytes.Buffer
+	err = gob.NewEncoder(&buff).Encode(authorities)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return b.Put([]byte(authoritiesKey), buff.Bytes())
+}
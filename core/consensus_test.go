@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// newTestPoAEngine returns an engine whose authorities are wallets, in their signing order
+func newTestPoAEngine(t *testing.T, wallets []*Wallet) *PoAEngine {
+	t.Helper()
+
+	var authorities [][]byte
+	for _, w := range wallets {
+		authorities = append(authorities, HashPublicKey(w.PublicKey))
+	}
+	engine, err := NewPoAEngine(authorities)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return engine
+}
+
+func TestPoASealHasLowS(t *testing.T) {
+	w := newTestWallets(t, 1)[0]
+	engine := newTestPoAEngine(t, []*Wallet{w})
+	if err := engine.SetSigner(w); err != nil {
+		t.Fatal(err)
+	}
+
+	block := &Block{BlockHeader: BlockHeader{PrevHash: make([]byte, 32), MerkleRoot: make([]byte, 32), Height: 1}}
+	if err := engine.Seal(context.Background(), block, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.VerifySeal(block); err != nil {
+		t.Fatalf("VerifySeal of a sealed block returned %v", err)
+	}
+
+	// N-s is a valid ECDSA signature too, which would give the block another encoding
+	block.Signature = highS(block.Signature)
+	if err := engine.VerifySeal(block); !errors.Is(err, ErrInvalidSeal) {
+		t.Fatalf("VerifySeal of a high s signature returned %v, want %v", err, ErrInvalidSeal)
+	}
+}
+
+func TestPoASignersTakeTurns(t *testing.T) {
+	config := &Config{DataDir: t.TempDir(), Network: RegTest}
+	addresses := []string{newTestAddress(t, config), newTestAddress(t, config)}
+	bc, err := CreateBlockchain(addresses, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Db.Close() })
+
+	wallets, err := NewWallets(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signers []*Wallet
+	for _, address := range addresses {
+		w, err := wallets.GetWallet(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, &w)
+	}
+	engine, ok := bc.Engine().(*PoAEngine)
+	if !ok {
+		t.Fatalf("engine is %T, want proof of authority", bc.Engine())
+	}
+	if err := engine.SetSigner(newTestWallets(t, 1)[0]); !errors.Is(err, ErrNotAuthority) {
+		t.Fatalf("SetSigner of another key returned %v, want %v", err, ErrNotAuthority)
+	}
+
+	// The block at height h is signed by authority h modulo 2
+	mp := NewMempool(bc)
+	for height := 1; height <= 4; height++ {
+		inTurn, other := signers[height%2], signers[(height+1)%2]
+
+		if err := engine.SetSigner(other); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bc.MineBlock(context.Background(), addresses[0], mp, nil); !errors.Is(err, ErrNotInTurn) {
+			t.Fatalf("MineBlock at height %d by the authority out of turn returned %v, want %v", height, err, ErrNotInTurn)
+		}
+
+		if err := engine.SetSigner(inTurn); err != nil {
+			t.Fatal(err)
+		}
+		block := mineBlocks(t, bc, addresses[0], mp, 1)[0]
+		if err := engine.VerifySeal(block); err != nil {
+			t.Fatalf("VerifySeal at height %d returned %v", height, err)
+		}
+
+		// A valid signature of the authority out of turn doesn't seal the block
+		forged := *block
+		forged.Signer = other.PublicKey
+		forged.Signature, err = signHash(&other.PrivateKey, block.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.VerifySeal(&forged); !errors.Is(err, ErrInvalidSeal) {
+			t.Fatalf("VerifySeal at height %d of the authority out of turn returned %v, want %v", height, err, ErrInvalidSeal)
+		}
+	}
+}
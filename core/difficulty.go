@@ -0,0 +1,126 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"time"
+)
+
+// maxRetargetFactor limits how much difficulty changes in one retarget
+const maxRetargetFactor = 4
+
+// maxFutureBlockTime is how far the timestamp of a block may be ahead of the clock of the node
+const maxFutureBlockTime = 2 * time.Hour
+
+var (
+	ErrBadDifficulty = errors.New("block bits don't match the expected difficulty")
+	ErrBadHeight     = errors.New("block height doesn't follow its parent")
+	ErrTimeTooOld    = errors.New("block timestamp is not after the median time of the blocks before it")
+	ErrTimeTooNew    = errors.New("block timestamp is too far in the future")
+)
+
+// checkTimestamp checks a block on top of parent is later than the median time past of parent
+// and at most maxFutureBlockTime ahead of now. Retargeting uses timestamps,
+// so otherwise miners could lower the difficulty by writing false ones
+func (bc *Blockchain) checkTimestamp(header, parent *BlockHeader) error {
+	medianTime, err := bc.headerMedianTimePast(parent)
+	if err != nil {
+		return err
+	}
+	if int64(header.TimeStamp) <= medianTime {
+		return ErrTimeTooOld
+	}
+	if int64(header.TimeStamp) > time.Now().Add(maxFutureBlockTime).Unix() {
+		return ErrTimeTooNew
+	}
+
+	return nil
+}
+
+// nextTimeStamp returns the timestamp of a new block on top of parent, which is now
+// unless the median time past of parent is not earlier
+func (bc *Blockchain) nextTimeStamp(parent *BlockHeader) (int32, error) {
+	medianTime, err := bc.headerMedianTimePast(parent)
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(max(time.Now().Unix(), medianTime+1)), nil
+}
+
+// CompactToBig converts compact "bits" form into a target.
+// The first byte is the length of the target in bytes and the other three are its most significant bytes
+func CompactToBig(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	exponent := uint(bits >> 24)
+
+	if exponent <= 3 {
+		return big.NewInt(mantissa >> (8 * (3 - exponent)))
+	}
+
+	target := big.NewInt(mantissa)
+	return target.Lsh(target, 8*(exponent-3))
+}
+
+// BigToCompact converts a target into compact "bits" form
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	exponent := uint(len(target.Bytes()))
+	var mantissa uint32
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - exponent))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, 8*(exponent-3)).Uint64())
+	}
+
+	// The highest bit of mantissa is a sign bit, so keep it clear
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	return uint32(exponent<<24) | mantissa
+}
+
+// nextBits calculates difficulty of the block following parent.
+// Every RetargetInterval blocks the target is scaled by how far
+// the observed block time was from TargetBlockTime
+func (bc *Blockchain) nextBits(parent *BlockHeader) (uint32, error) {
+	params := bc.params
+	height := parent.Height + 1
+	if params.NoRetargeting || height%params.RetargetInterval != 0 {
+		return parent.Bits, nil
+	}
+
+	first := parent
+	for i := 0; i < params.RetargetInterval-1; i++ {
+		header, err := bc.GetBlockHeader(first.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+		first = header
+	}
+
+	// RetargetInterval blocks are separated by RetargetInterval-1 gaps
+	targetTimespan := params.TargetBlockTime * int64(params.RetargetInterval-1)
+	actualTimespan := int64(parent.TimeStamp) - int64(first.TimeStamp)
+	if actualTimespan < targetTimespan/maxRetargetFactor {
+		actualTimespan = targetTimespan / maxRetargetFactor
+	}
+	if actualTimespan > targetTimespan*maxRetargetFactor {
+		actualTimespan = targetTimespan * maxRetargetFactor
+	}
+
+	target := CompactToBig(parent.Bits)
+	target.Mul(target, big.NewInt(actualTimespan))
+	target.Div(target, big.NewInt(targetTimespan))
+	powLimit := params.PowLimit()
+	if target.Cmp(powLimit) > 0 {
+		target.Set(powLimit)
+	}
+
+	return BigToCompact(target), nil
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	tests := []struct {
+		bits   uint32
+		target *big.Int
+	}{
+		{0x03123456, big.NewInt(0x123456)},
+		{0x02123400, big.NewInt(0x1234)},
+		{0x01120000, big.NewInt(0x12)},
+		{0x04123456, big.NewInt(0x12345600)},
+		// The highest mantissa bit is a sign bit, so 0x80 moves into the next byte
+		{0x02008000, big.NewInt(0x80)},
+	}
+	for _, tt := range tests {
+		if got := CompactToBig(tt.bits); got.Cmp(tt.target) != 0 {
+			t.Errorf("CompactToBig(%08x) = %x, want %x", tt.bits, got, tt.target)
+		}
+		if got := BigToCompact(tt.target); got != tt.bits {
+			t.Errorf("BigToCompact(%x) = %08x, want %08x", tt.target, got, tt.bits)
+		}
+	}
+
+	powLimit := RegTestParams.PowLimit()
+	if got := CompactToBig(BigToCompact(powLimit)); got.Cmp(powLimit) != 0 {
+		t.Errorf("pow limit %x became %x", powLimit, got)
+	}
+}
+
+// storeTestHeaders stores headers on top of the last block of bc, spaced by the given seconds, with bits.
+// The last of them becomes the last block and is returned
+func storeTestHeaders(t *testing.T, bc *Blockchain, bits uint32, spacings []int32) *BlockHeader {
+	t.Helper()
+
+	parent, err := bc.GetBlockHeader(bc.tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bc.Db.Update(func(tx *bolt.Tx) error {
+		for _, spacing := range spacings {
+			header := &BlockHeader{
+				Version:   BlockVersion,
+				PrevHash:  parent.Hash(),
+				TimeStamp: parent.TimeStamp + spacing,
+				Bits:      bits,
+				Height:    parent.Height + 1,
+			}
+			parentEntry, err := getIndexEntry(tx, parent.Hash())
+			if err != nil {
+				return err
+			}
+			block := &Block{BlockHeader: *header, Hash: header.Hash()}
+			if err := putIndexEntry(tx, newIndexEntry(parentEntry, block)); err != nil {
+				return err
+			}
+			parent = header
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.setTip(parent.Hash())
+
+	return parent
+}
+
+func TestNextBits(t *testing.T) {
+	bc, _ := newTestChain(t)
+	params := RegTestParams
+	params.NoRetargeting = false
+	bc.params = &params
+
+	bits := BigToCompact(new(big.Int).Rsh(params.PowLimit(), 16))
+	interval := params.RetargetInterval
+	targetTimespan := params.TargetBlockTime * int64(interval-1)
+	tests := []struct {
+		name    string
+		spacing int64
+		// Target is scaled by timespan/targetTimespan
+		timespan int64
+	}{
+		{"on time", params.TargetBlockTime, targetTimespan},
+		{"twice as fast", params.TargetBlockTime / 2, targetTimespan / 2},
+		{"twice as slow", params.TargetBlockTime * 2, targetTimespan * 2},
+		{"limited speedup", 0, targetTimespan / maxRetargetFactor},
+		{"limited slowdown", params.TargetBlockTime * 10, targetTimespan * maxRetargetFactor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spacings := make([]int32, interval-1)
+			for i := range spacings {
+				spacings[i] = int32(tt.spacing)
+			}
+			first := storeTestHeaders(t, bc, bits, []int32{1})
+			if first.Height%interval != 0 {
+				first = storeTestHeaders(t, bc, bits, make([]int32, interval-first.Height%interval))
+			}
+			last := storeTestHeaders(t, bc, bits, spacings)
+
+			got, err := bc.nextBits(last)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := CompactToBig(bits)
+			want.Mul(want, big.NewInt(tt.timespan))
+			want.Div(want, big.NewInt(targetTimespan))
+			if got != BigToCompact(want) {
+				t.Fatalf("bits are %08x, want %08x", got, BigToCompact(want))
+			}
+
+			// Blocks within the interval keep the bits of their parent
+			within := storeTestHeaders(t, bc, got, []int32{1})
+			if next, err := bc.nextBits(within); err != nil || next != got {
+				t.Fatalf("bits within interval are %08x, %v, want %08x", next, err, got)
+			}
+		})
+	}
+}
+
+func TestNextBitsIsLimitedByPowLimit(t *testing.T) {
+	bc, _ := newTestChain(t)
+	params := RegTestParams
+	params.NoRetargeting = false
+	bc.params = &params
+
+	bits := BigToCompact(params.PowLimit())
+	spacings := make([]int32, params.RetargetInterval-1)
+	for i := range spacings {
+		spacings[i] = int32(params.TargetBlockTime * 2)
+	}
+	last := storeTestHeaders(t, bc, bits, spacings)
+
+	got, err := bc.nextBits(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != bits {
+		t.Fatalf("bits are %08x, want pow limit %08x", got, bits)
+	}
+}
+
+func TestBlockTimestamp(t *testing.T) {
+	bc, address := newTestChain(t)
+	mineBlocks(t, bc, address, NewMempool(bc), 12)
+
+	parent, err := bc.GetBlockHeader(bc.tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+	medianTime, err := bc.headerMedianTimePast(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		timeStamp int64
+		want      error
+	}{
+		{"after median time", medianTime + 1, nil},
+		{"at median time", medianTime, ErrTimeTooOld},
+		{"before median time", medianTime - 100, ErrTimeTooOld},
+		{"within two hours", time.Now().Add(maxFutureBlockTime - time.Minute).Unix(), nil},
+		{"beyond two hours", time.Now().Add(maxFutureBlockTime + time.Minute).Unix(), ErrTimeTooNew},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := newTestBlock(t, bc, []*Transaction{newTestCoinbase(t, bc, address)})
+			block.TimeStamp = int32(tt.timeStamp)
+			err := bc.engine.Seal(context.Background(), block, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := bc.ValidateBlock(block); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateBlock returned %v, want %v", err, tt.want)
+			}
+			if tt.want == nil {
+				return
+			}
+			if _, err := bc.ImportBlock(block); !errors.Is(err, tt.want) {
+				t.Fatalf("ImportBlock returned %v, want %v", err, tt.want)
+			}
+			if _, err := bc.GetBlock(block.Hash); !errors.Is(err, ErrBlockNotFound) {
+				t.Fatal("rejected block is stored")
+			}
+		})
+	}
+}
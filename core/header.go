@@ -0,0 +1,85 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// BlockVersion is the version of headers created by this node
+const BlockVersion = 1
+
+// HeaderSize is the number of bytes of a serialized header
+const HeaderSize = 4 + 32 + 32 + 4 + 4 + 4 + 4
+
+// nonceOffset is where the nonce starts in a serialized header
+const nonceOffset = 4 + 32 + 32 + 4 + 4
+
+var ErrBadHeaderSize = errors.New("serialized header has a wrong size")
+
+// BlockHeader holds the fields of a block which its hash commits to.
+// Transactions are committed through MerkleRoot, so a header can be checked without them
+type BlockHeader struct {
+	Version    int32
+	PrevHash   []byte `validate:"required"`
+	MerkleRoot []byte `validate:"required"`
+	TimeStamp  int32  `validate:"required"`
+	Bits       uint32 `validate:"required"`
+	Nonce      uint32
+	Height     int `validate:"min=0"`
+}
+
+// Serialize encodes the header into HeaderSize bytes: version, prev hash, merkle root,
+// timestamp, bits, nonce and height, with numbers in little endian.
+// Genesis has no prev hash, which is encoded as zeros
+func (h *BlockHeader) Serialize() []byte {
+	data := make([]byte, HeaderSize)
+
+	binary.LittleEndian.PutUint32(data[0:4], uint32(h.Version))
+	copy(data[4:36], h.PrevHash)
+	copy(data[36:68], h.MerkleRoot)
+	binary.LittleEndian.PutUint32(data[68:72], uint32(h.TimeStamp))
+	binary.LittleEndian.PutUint32(data[72:76], h.Bits)
+	binary.LittleEndian.PutUint32(data[nonceOffset:nonceOffset+4], h.Nonce)
+	binary.LittleEndian.PutUint32(data[80:84], uint32(h.Height))
+
+	return data
+}
+
+// DeserializeHeader decodes a header encoded by Serialize
+func DeserializeHeader(data []byte) (*BlockHeader, error) {
+	if len(data) != HeaderSize {
+		return nil, ErrBadHeaderSize
+	}
+
+	h := &BlockHeader{
+		Version:    int32(binary.LittleEndian.Uint32(data[0:4])),
+		MerkleRoot: append([]byte{}, data[36:68]...),
+		TimeStamp:  int32(binary.LittleEndian.Uint32(data[68:72])),
+		Bits:       binary.LittleEndian.Uint32(data[72:76]),
+		Nonce:      binary.LittleEndian.Uint32(data[nonceOffset : nonceOffset+4]),
+		Height:     int(binary.LittleEndian.Uint32(data[80:84])),
+	}
+	if !isZero(data[4:36]) {
+		h.PrevHash = append([]byte{}, data[4:36]...)
+	}
+
+	return h, nil
+}
+
+// Hash is the SHA-256 of the serialized header, which is the block hash
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.Serialize())
+
+	return hash[:]
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHeaderRoundTrip(t *testing.T) {
+	bc, address := newTestChain(t)
+	block := mineBlocks(t, bc, address, NewMempool(bc), 1)[0]
+
+	for _, h := range []*BlockHeader{&bc.params.GenesisBlock().BlockHeader, &block.BlockHeader} {
+		data := h.Serialize()
+		if len(data) != HeaderSize {
+			t.Fatalf("serialized header has %d bytes, want %d", len(data), HeaderSize)
+		}
+
+		decoded, err := DeserializeHeader(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, h) {
+			t.Fatalf("decoded header is %+v, want %+v", decoded, h)
+		}
+	}
+
+	if !bytes.Equal(block.BlockHeader.Hash(), block.Hash) {
+		t.Fatalf("header hash is %x, want the block hash %x", block.BlockHeader.Hash(), block.Hash)
+	}
+	if _, err := DeserializeHeader(block.BlockHeader.Serialize()[:HeaderSize-1]); !errors.Is(err, ErrBadHeaderSize) {
+		t.Fatalf("DeserializeHeader of a short header returned %v, want %v", err, ErrBadHeaderSize)
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+)
+
+const heightIndexBucket = "heightindex"
+
+// heightKey encodes height big-endian so keys are sorted by height
+func heightKey(height int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(height))
+
+	return key
+}
+
+// GetBlockHash returns the hash of the main chain block at height
+func (bc *Blockchain) GetBlockHash(height int) ([]byte, error) {
+	var hash []byte
+
+	err := bc.Db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(heightIndexBucket)).Get(heightKey(height))
+		if value == nil {
+			return ErrBlockNotFound
+		}
+		hash = append([]byte{}, value...)
+
+		return nil
+	})
+
+	return hash, err
+}
+
+// GetBlockByHeight returns the main chain block at height
+func (bc *Blockchain) GetBlockByHeight(height int) (Block, error) {
+	hash, err := bc.GetBlockHash(height)
+	if err != nil {
+		return Block{}, err
+	}
+
+	return bc.GetBlock(hash)
+}
+
+// ensureHeightIndex builds the height index from the main chain
+// for blockchains created before the index existed
+func ensureHeightIndex(db *bolt.DB, last []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(heightIndexBucket)) != nil {
+			return nil
+		}
+		index, err := tx.CreateBucket([]byte(heightIndexBucket))
+		if err != nil {
+			return err
+		}
+
+		blocks := tx.Bucket([]byte("blocks"))
+		for hash := last; len(hash) > 0; {
+			block, err := DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return err
+			}
+			err = index.Put(heightKey(block.Height), block.Hash)
+			if err != nil {
+				return err
+			}
+			hash = block.PrevHash
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"sort"
+)
+
+// LockTimeThreshold separates the two kinds of lock times:
+// smaller values are block heights and larger ones unix times
+const LockTimeThreshold = 500000000
+
+// The low bits of an input sequence are a relative lock on the output it spends:
+// the number of blocks the output has to be deep or, with SequenceTimeFlag,
+// the number of seconds that have to pass since its block. Higher bits are ignored.
+// A SequenceFinal input has no relative lock, and a transaction whose inputs are all final has no lock time
+const (
+	SequenceTimeFlag  = 1 << 22
+	SequenceValueMask = SequenceTimeFlag - 1
+	SequenceFinal     = 0xffffffff
+)
+
+// medianTimeBlocks is the number of blocks whose median timestamp is the time time locks are checked against.
+// Unlike the timestamp of a single block, miners can't move it much, as every block has to be later
+// than the median of the blocks before it and can't be far in the future, see checkTimestamp
+const medianTimeBlocks = 11
+
+var (
+	ErrNonFinal     = errors.New("transaction is locked until a later block or time")
+	ErrSequenceLock = errors.New("input spends an output which is too recent for its relative lock")
+)
+
+// medianTimePast returns the median timestamp of the main chain block at height and the blocks before it.
+// Heights below genesis get the time of genesis
+func (bc *Blockchain) medianTimePast(height int) (int64, error) {
+	hash, err := bc.GetBlockHash(max(height, 0))
+	if err != nil {
+		return 0, err
+	}
+	header, err := bc.GetBlockHeader(hash)
+	if err != nil {
+		return 0, err
+	}
+
+	return bc.headerMedianTimePast(header)
+}
+
+// headerMedianTimePast returns the median timestamp of the block of header and the blocks before it,
+// which needn't be in the main chain
+func (bc *Blockchain) headerMedianTimePast(header *BlockHeader) (int64, error) {
+	var times []int64
+
+	for {
+		times = append(times, int64(header.TimeStamp))
+		if len(times) == medianTimeBlocks || len(header.PrevHash) == 0 {
+			break
+		}
+
+		var err error
+		header, err = bc.GetBlockHeader(header.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	return times[len(times)/2], nil
+}
+
+// checkLocks checks the lock time of tx and the relative locks of its inputs allow it in the block at v.height.
+// Time is the median time past of the previous block, which is known before the block is mined
+func (v *utxoView) checkLocks(tx *Transaction) error {
+	if tx.isFinal() {
+		return nil
+	}
+
+	if tx.LockTime >= LockTimeThreshold {
+		now, err := v.bc.medianTimePast(v.height - 1)
+		if err != nil {
+			return err
+		}
+		if now < int64(tx.LockTime) {
+			return ErrNonFinal
+		}
+	} else if v.height < int(tx.LockTime) {
+		return ErrNonFinal
+	}
+
+	for _, vin := range tx.Vin {
+		lock := int(vin.Sequence & SequenceValueMask)
+		if lock == 0 || vin.Sequence == SequenceFinal {
+			continue
+		}
+		outHeight := v.outputs[hex.EncodeToString(vin.Txid)].Height
+
+		if vin.Sequence&SequenceTimeFlag == 0 {
+			if v.height-outHeight < lock {
+				return ErrSequenceLock
+			}
+			continue
+		}
+
+		// Like the block time, the time of the output is the median time past before its block
+		now, err := v.bc.medianTimePast(v.height - 1)
+		if err != nil {
+			return err
+		}
+		created, err := v.bc.medianTimePast(outHeight - 1)
+		if err != nil {
+			return err
+		}
+		if now-created < int64(lock) {
+			return ErrSequenceLock
+		}
+	}
+
+	return nil
+}
+
+// isFinal checks every input of tx is final, so its lock time is not enforced
+func (tx *Transaction) isFinal() bool {
+	for _, vin := range tx.Vin {
+		if vin.Sequence != SequenceFinal {
+			return false
+		}
+	}
+
+	return true
+}
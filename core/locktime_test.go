@@ -0,0 +1,29 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLockTimeOfFinalTransaction(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+	mineBlocks(t, bc, address, mp, bc.params.CoinbaseMaturity)
+
+	tx, err := NewUTXOTransaction(address, address, 1, 0, 100, &UTXOSet{bc, mp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add(tx); !errors.Is(err, ErrNonFinal) {
+		t.Fatalf("Add returned %v, want %v", err, ErrNonFinal)
+	}
+
+	// With only final inputs the lock time is not enforced
+	for i := range tx.Vin {
+		tx.Vin[i].Sequence = SequenceFinal
+	}
+	resignTransaction(t, bc, tx, address)
+	if err := mp.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,297 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"github.com/boltdb/bolt"
+	"sort"
+	"sync"
+)
+
+// maxBlockTransactions limits how many mempool transactions go into one block
+const maxBlockTransactions = 100
+
+const mempoolBucket = "mempool"
+
+var (
+	ErrCoinbaseInMempool = errors.New("coinbase transaction can't be added to mempool")
+	ErrAlreadyInMempool  = errors.New("transaction is already in mempool")
+	ErrMempoolConflict   = errors.New("transaction spends an output already spent in mempool")
+)
+
+// Mempool keeps valid transactions which are not in a block yet
+type Mempool struct {
+	bc *Blockchain
+
+	mu    sync.Mutex
+	txs   map[string]*mempoolEntry
+	spent map[string]string
+}
+
+type mempoolEntry struct {
+	tx   *Transaction
+	fee  int
+	size int
+}
+
+// hasHigherFeeRate compares fee per byte of two entries without dividing
+func (e *mempoolEntry) hasHigherFeeRate(other *mempoolEntry) bool {
+	return e.fee*other.size > other.fee*e.size
+}
+
+// NewMempool creates an empty mempool validating transactions against bc
+func NewMempool(bc *Blockchain) *Mempool {
+	return &Mempool{
+		bc:    bc,
+		txs:   make(map[string]*mempoolEntry),
+		spent: make(map[string]string),
+	}
+}
+
+// LoadMempool creates a mempool with the transactions saved in the blockchain file.
+// Transactions which are no longer valid, e.g. because they are in a block now, are dropped
+func LoadMempool(bc *Blockchain) (*Mempool, error) {
+	mp := NewMempool(bc)
+
+	var txs []Transaction
+	err := bc.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(mempoolBucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			transaction, err := DeserializeTransaction(v)
+			if err != nil {
+				return err
+			}
+			txs = append(txs, transaction)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range txs {
+		err := mp.Add(&txs[i])
+		var validationErr *ValidationError
+		if err != nil && !errors.As(err, &validationErr) {
+			return nil, err
+		}
+	}
+
+	return mp, nil
+}
+
+// Save replaces the transactions saved in the blockchain file with the ones in mempool
+func (mp *Mempool) Save() error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return mp.bc.Db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(mempoolBucket)) != nil {
+			err := tx.DeleteBucket([]byte(mempoolBucket))
+			if err != nil {
+				return err
+			}
+		}
+		b, err := tx.CreateBucket([]byte(mempoolBucket))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range mp.txs {
+			err := b.Put(entry.tx.ID, entry.tx.Serialize())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Add validates a transaction against unspent outputs of the chain
+// and accepts it if its scripts are standard and none of its inputs are spent by another mempool transaction
+func (mp *Mempool) Add(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return ErrCoinbaseInMempool
+	}
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return &ValidationError{tx.ID, ErrBadTxID}
+	}
+	if err := tx.checkStandard(); err != nil {
+		return &ValidationError{tx.ID, err}
+	}
+
+	txID := hex.EncodeToString(tx.ID)
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if _, ok := mp.txs[txID]; ok {
+		return ErrAlreadyInMempool
+	}
+	for _, vin := range tx.Vin {
+		if _, ok := mp.spent[outpointKey(vin)]; ok {
+			return &ValidationError{tx.ID, ErrMempoolConflict}
+		}
+	}
+
+	// The transaction can go into the next block at the earliest
+	bestHeight, err := mp.bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	view, err := mp.bc.newUTXOView([]*Transaction{tx}, bestHeight+1)
+	if err != nil {
+		return err
+	}
+	fee, err := view.checkTransaction(tx, make(map[string]bool))
+	if err != nil {
+		return &ValidationError{tx.ID, err}
+	}
+	err = view.checkCleanStack(tx)
+	if err != nil {
+		return &ValidationError{tx.ID, err}
+	}
+
+	mp.txs[txID] = &mempoolEntry{tx, fee, tx.Size()}
+	for _, vin := range tx.Vin {
+		mp.spent[outpointKey(vin)] = txID
+	}
+
+	return nil
+}
+
+// Get returns a mempool transaction by its ID
+func (mp *Mempool) Get(id []byte) (*Transaction, bool) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	entry, ok := mp.txs[hex.EncodeToString(id)]
+	if !ok {
+		return nil, false
+	}
+
+	return entry.tx, true
+}
+
+// Has checks whether a transaction is in mempool
+func (mp *Mempool) Has(id []byte) bool {
+	_, ok := mp.Get(id)
+
+	return ok
+}
+
+// IsSpent checks whether an output is spent by a mempool transaction
+func (mp *Mempool) IsSpent(txID []byte, index int) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	_, ok := mp.spent[outpointKey(TXInput{txID, index, nil, 0})]
+
+	return ok
+}
+
+// Count returns the number of transactions in mempool
+func (mp *Mempool) Count() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return len(mp.txs)
+}
+
+// Remove drops a transaction from mempool and reports whether it was there
+func (mp *Mempool) Remove(id []byte) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return mp.remove(hex.EncodeToString(id))
+}
+
+func (mp *Mempool) remove(txID string) bool {
+	entry, ok := mp.txs[txID]
+	if !ok {
+		return false
+	}
+
+	for _, vin := range entry.tx.Vin {
+		delete(mp.spent, outpointKey(vin))
+	}
+	delete(mp.txs, txID)
+
+	return true
+}
+
+// RemoveBlockTransactions evicts transactions included in a block
+// and transactions spending the same outputs as the block does
+func (mp *Mempool) RemoveBlockTransactions(block *Block) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		mp.remove(hex.EncodeToString(tx.ID))
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, vin := range tx.Vin {
+			if conflict, ok := mp.spent[outpointKey(vin)]; ok {
+				mp.remove(conflict)
+			}
+		}
+	}
+}
+
+// UpdateChain follows a change of the main chain. Transactions of connected blocks are evicted
+// and transactions of disconnected blocks are added again if they are still valid.
+// Mempool transactions only spend outputs of the chain, so a disconnected transaction
+// spending another disconnected one is dropped
+func (mp *Mempool) UpdateChain(update *ChainUpdate) {
+	for _, block := range update.Connected {
+		mp.RemoveBlockTransactions(block)
+	}
+
+	// Older blocks go first, as their outputs may be spent by later ones
+	for i := len(update.Disconnected) - 1; i >= 0; i-- {
+		for _, tx := range update.Disconnected[i].Transactions {
+			if !tx.IsCoinbase() {
+				mp.Add(tx)
+			}
+		}
+	}
+}
+
+// BlockTemplate returns mempool transactions ordered by fee rate, highest first.
+// A miner puts a coinbase in front of them and passes them to NewBlock
+func (mp *Mempool) BlockTemplate() []*Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	entries := make([]*mempoolEntry, 0, len(mp.txs))
+	for _, entry := range mp.txs {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].hasHigherFeeRate(entries[j]) || entries[j].hasHigherFeeRate(entries[i]) {
+			return entries[i].hasHigherFeeRate(entries[j])
+		}
+		return bytes.Compare(entries[i].tx.ID, entries[j].tx.ID) < 0
+	})
+
+	if len(entries) > maxBlockTransactions {
+		entries = entries[:maxBlockTransactions]
+	}
+
+	txs := make([]*Transaction, 0, len(entries))
+	for _, entry := range entries {
+		txs = append(txs, entry.tx)
+	}
+
+	return txs
+}
@@ -1,6 +1,9 @@
 package core
 
-import "crypto/sha256"
+import (
+	"bytes"
+	"crypto/sha256"
+)
 
 type MerkleTree struct {
 	Root       *Node
@@ -16,32 +19,36 @@ type Node struct {
 	Hash   []byte
 }
 
+// NewMerkleTree builds a tree over data. A level with an odd number of nodes
+// pairs its last node with itself
 func NewMerkleTree(data [][]byte) *MerkleTree {
-	var nodes []*Node
-
-	// Make it even
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
-	}
+	var leafs []*Node
 
 	// Hash transactions
 	for _, tx := range data {
 		node := NewMerkleNode(nil, nil, tx)
-		nodes = append(nodes, node)
+		leafs = append(leafs, node)
 	}
 
-	for i := 0; i < len(data)/2; i++ {
-		var newLevel []*Node
+	nodes := leafs
+	for {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
 
+		var newLevel []*Node
 		for j := 0; j < len(nodes); j += 2 {
 			node := NewMerkleNode(nodes[j], nodes[j+1], nil)
 			newLevel = append(newLevel, node)
 		}
 
 		nodes = newLevel
+		if len(nodes) <= 1 {
+			break
+		}
 	}
 
-	mTree := MerkleTree{nodes[0], nodes[0].Hash, nodes}
+	mTree := MerkleTree{nodes[0], nodes[0].Hash, leafs}
 	return &mTree
 }
 
@@ -64,3 +71,42 @@ func NewMerkleNode(left, right *Node, data []byte) *Node {
 
 	return &mNode
 }
+
+// MerkleStep is a sibling hash on the path from a leaf to the root
+// and whether it is hashed in front of the path hash
+type MerkleStep struct {
+	Hash []byte
+	Left bool
+}
+
+// Proof returns the path from leaf index to the root, which proves the leaf is in the tree
+// to anyone who knows the root
+func (t *MerkleTree) Proof(index int) []MerkleStep {
+	var proof []MerkleStep
+
+	for node := t.Leafs[index]; node.Parent != nil; node = node.Parent {
+		parent := node.Parent
+		if parent.Left == node {
+			proof = append(proof, MerkleStep{parent.Right.Hash, false})
+		} else {
+			proof = append(proof, MerkleStep{parent.Left.Hash, true})
+		}
+	}
+
+	return proof
+}
+
+// VerifyMerkleProof checks proof leads from data of a leaf to root
+func VerifyMerkleProof(data []byte, proof []MerkleStep, root []byte) bool {
+	hash := sha256.Sum256(data)
+
+	for _, step := range proof {
+		if step.Left {
+			hash = sha256.Sum256(append(append([]byte{}, step.Hash...), hash[:]...))
+		} else {
+			hash = sha256.Sum256(append(hash[:], step.Hash...))
+		}
+	}
+
+	return bytes.Equal(hash[:], root)
+}
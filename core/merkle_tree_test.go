@@ -0,0 +1,149 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// merkleRoot computes the root level by level, pairing the last hash of an odd level with itself
+func merkleRoot(data [][]byte) []byte {
+	var level [][]byte
+	for _, d := range data {
+		hash := sha256.Sum256(d)
+		level = append(level, hash[:])
+	}
+
+	for {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			hash := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+			next = append(next, hash[:])
+		}
+		level = next
+		if len(level) == 1 {
+			return level[0]
+		}
+	}
+}
+
+func testLeaves(n int) [][]byte {
+	var data [][]byte
+	for i := 0; i < n; i++ {
+		data = append(data, []byte(fmt.Sprintf("tx %d", i)))
+	}
+
+	return data
+}
+
+// newTestSpends returns n transactions which pay 1 coin to address,
+// each spending a block reward of another wallet
+func newTestSpends(t *testing.T, bc *Blockchain, address string, mp *Mempool, n int) []*Transaction {
+	t.Helper()
+
+	var senders []string
+	for i := 0; i < n; i++ {
+		from := newTestAddress(t, bc.config)
+		mineBlocks(t, bc, from, mp, 1)
+		senders = append(senders, from)
+	}
+	mineBlocks(t, bc, address, mp, bc.params.CoinbaseMaturity)
+
+	var txs []*Transaction
+	for _, from := range senders {
+		tx, err := NewUTXOTransaction(from, address, 1, 0, 0, &UTXOSet{bc, mp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	return txs
+}
+
+func TestMerkleTreeRoot(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			data := testLeaves(n)
+			tree := NewMerkleTree(data)
+
+			if want := merkleRoot(data); !bytes.Equal(tree.merkleRoot, want) {
+				t.Fatalf("root is %x, want %x", tree.merkleRoot, want)
+			}
+			if len(tree.Leafs) != n {
+				t.Fatalf("tree has %d leaves, want %d", len(tree.Leafs), n)
+			}
+		})
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		data := testLeaves(n)
+		tree := NewMerkleTree(data)
+
+		for i := range data {
+			proof := tree.Proof(i)
+			if !VerifyMerkleProof(data[i], proof, tree.merkleRoot) {
+				t.Fatalf("proof of leaf %d of %d doesn't verify", i, n)
+			}
+			if VerifyMerkleProof([]byte("other"), proof, tree.merkleRoot) {
+				t.Fatalf("proof of leaf %d of %d verifies other data", i, n)
+			}
+		}
+	}
+}
+
+func TestBlockWithDuplicateTransactionIsRejected(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+
+	txs := append([]*Transaction{newTestCoinbase(t, bc, address)}, newTestSpends(t, bc, address, mp, 2)...)
+	block := newTestBlock(t, bc, txs)
+
+	// Three transactions pair the last one with itself, so repeating it keeps the root
+	block.Transactions = append(block.Transactions, txs[2])
+	if !bytes.Equal(block.HashTransactions(), block.MerkleRoot) {
+		t.Fatal("repeated last transaction changed the merkle root")
+	}
+
+	if err := bc.ValidateBlock(block); !errors.Is(err, ErrDuplicateTx) {
+		t.Fatalf("ValidateBlock returned %v, want %v", err, ErrDuplicateTx)
+	}
+	if _, err := bc.ImportBlock(block); !errors.Is(err, ErrDuplicateTx) {
+		t.Fatalf("ImportBlock returned %v, want %v", err, ErrDuplicateTx)
+	}
+
+	// The block without the repeated transaction is still accepted
+	block.Transactions = txs
+	if _, err := bc.ImportBlock(block); err != nil {
+		t.Fatalf("ImportBlock returned %v", err)
+	}
+	if !bytes.Equal(bc.tip(), block.Hash) {
+		t.Fatal("block is not the last block")
+	}
+}
+
+func TestMineBlockWithManyTransactions(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+
+	for _, tx := range newTestSpends(t, bc, address, mp, 6) {
+		if err := mp.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	block := mineBlocks(t, bc, address, mp, 1)[0]
+	if len(block.Transactions) != 7 {
+		t.Fatalf("block has %d transactions, want 7", len(block.Transactions))
+	}
+	if mp.Count() != 0 {
+		t.Fatalf("mempool has %d transactions left", mp.Count())
+	}
+}
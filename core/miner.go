@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrTxDropped is wrapped into a validation error of MineBlock when the blamed transaction
+// is dropped from mempool, so mining the next template can succeed
+var ErrTxDropped = errors.New("invalid transaction is dropped from mempool")
+
+// MineBlock mines the next block with the block template of mp
+// and pays subsidy and fees of the block to address.
+// Mining stops when ctx is done and report gets the hash rate meanwhile.
+// A transaction which turns out to be invalid is dropped from mp, so the next template can be mined
+func (bc *Blockchain) MineBlock(ctx context.Context, address string, mp *Mempool, report HashRateFunc) (*Block, error) {
+	txs := mp.BlockTemplate()
+
+	// Every extra nonce changes the coinbase and so the merkle root,
+	// which gives a new range of nonces to try
+	for extraNonce := 0; ; extraNonce++ {
+		cbTx, err := bc.newRewardTX(address, txs, extraNonce)
+		if err != nil {
+			return nil, dropInvalidTx(mp, err)
+		}
+
+		block, err := bc.AddBlockContext(ctx, append([]*Transaction{cbTx}, txs...), report)
+		if errors.Is(err, ErrNonceExhausted) {
+			continue
+		}
+		if err != nil {
+			return nil, dropInvalidTx(mp, err)
+		}
+
+		mp.RemoveBlockTransactions(block)
+
+		return block, nil
+	}
+}
+
+// dropInvalidTx removes the transaction a validation error blames from mp and returns err,
+// wrapped with ErrTxDropped if the transaction was in mp
+func dropInvalidTx(mp *Mempool, err error) error {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) && mp.Remove(validationErr.TxID) {
+		return fmt.Errorf("%w: %w", ErrTxDropped, err)
+	}
+
+	return err
+}
+
+// newRewardTX creates a coinbase paying the subsidy of the next block and fees of txs to address.
+// The coinbase data holds the height and extraNonce
+func (bc *Blockchain) newRewardTX(address string, txs []*Transaction, extraNonce int) (*Transaction, error) {
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	fees, err := bc.Fees(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	height := bestHeight + 1
+	data := fmt.Sprintf("height %d extra nonce %d", height, extraNonce)
+
+	return NewCoinbaseTX(address, data, bc.params.BlockSubsidy(height)+fees, bc.params)
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMineBlockDropsInvalidTransaction(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+	mineBlocks(t, bc, address, mp, bc.params.CoinbaseMaturity)
+
+	tx, err := NewUTXOTransaction(address, address, 1, 0, 0, &UTXOSet{bc, mp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mp.Add(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A block of another mempool spends the same output, so tx is invalid now
+	other := NewMempool(bc)
+	conflict, err := NewUTXOTransaction(address, address, 2, 0, 0, &UTXOSet{bc, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.Add(conflict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, address, other, 1)
+
+	_, err = bc.MineBlock(context.Background(), address, mp, nil)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || !errors.Is(err, ErrTxDropped) {
+		t.Fatalf("MineBlock returned %v, want a validation error of a dropped transaction", err)
+	}
+	if mp.Has(tx.ID) {
+		t.Fatal("invalid transaction is still in the mempool")
+	}
+	mineBlocks(t, bc, address, mp, 1)
+}
+
+func TestDropInvalidTxOutsideMempool(t *testing.T) {
+	bc, _ := newTestChain(t)
+	mp := NewMempool(bc)
+
+	// A coinbase is never in the mempool, so mining the same template would fail again
+	err := dropInvalidTx(mp, &ValidationError{make([]byte, 32), ErrTxIDInUse})
+	if errors.Is(err, ErrTxDropped) {
+		t.Fatalf("dropInvalidTx returned %v for a transaction which isn't in mempool", err)
+	}
+	if !errors.Is(err, ErrTxIDInUse) {
+		t.Fatalf("dropInvalidTx returned %v, want %v", err, ErrTxIDInUse)
+	}
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+)
+
+var (
+	ErrNotMultiSig        = errors.New("address is not a multisig address")
+	ErrNothingToSign      = errors.New("wallet has no key which still has to sign the transaction")
+	ErrMissingSignatures  = errors.New("transaction has fewer signatures than its inputs require")
+	ErrPartialTransaction = errors.New("partial transaction is malformed")
+)
+
+// PartialTransaction is a spend of multisig outputs which collects signatures
+// from the wallets of the keys, e.g. in different wallet files.
+// PrevScripts are the multisig scripts the inputs have to satisfy, so signers don't need the chain.
+// Signatures keeps the signatures of every input by the index of the key which made them.
+// RedeemScript is set when the inputs spend pay to script hash outputs. PrevScripts are then
+// the redeem script, which Finalize reveals after the signatures
+type PartialTransaction struct {
+	Tx           Transaction
+	PrevScripts  [][]byte
+	Signatures   []map[int][]byte
+	RedeemScript []byte
+}
+
+// NewMultiSigTransaction creates an unsigned transaction paying amount from the multisig address from
+// to address to. Inputs exceed outputs by fee and the change goes back to from.
+// If from is a pay to script hash address, redeemScript is the multisig script it hashes
+func NewMultiSigTransaction(from, to string, amount, fee int, redeemScript []byte, UTXOSet *UTXOSet) (*PartialTransaction, error) {
+	params := UTXOSet.Blockchain.params
+	script, err := params.AddressScript(from)
+	if err != nil {
+		return nil, err
+	}
+
+	ptx := &PartialTransaction{}
+	multiSig := script
+	if scriptHash, ok := extractScriptHash(script); ok {
+		if !bytes.Equal(HashPublicKey(redeemScript), scriptHash) {
+			return nil, ErrRedeemScriptMismatch
+		}
+		multiSig = redeemScript
+		ptx.RedeemScript = redeemScript
+	}
+	if classifyScript(multiSig) != multiSigScript {
+		return nil, ErrNotMultiSig
+	}
+
+	out, err := NewTXOutput(amount, to, params)
+	if err != nil {
+		return nil, err
+	}
+	balance, validOutputs, err := UTXOSet.FindMyUTXOs(script, amount+fee)
+	if err != nil {
+		return nil, err
+	}
+	if balance < amount+fee {
+		return nil, ErrInsufficientFunds
+	}
+
+	for txid, outs := range validOutputs {
+		txID, err := hex.DecodeString(txid)
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range outs {
+			ptx.Tx.Vin = append(ptx.Tx.Vin, TXInput{txID, index, nil, 0})
+			ptx.PrevScripts = append(ptx.PrevScripts, multiSig)
+			ptx.Signatures = append(ptx.Signatures, make(map[int][]byte))
+		}
+	}
+
+	ptx.Tx.Vout = append(ptx.Tx.Vout, *out)
+	if balance > amount+fee {
+		ptx.Tx.Vout = append(ptx.Tx.Vout, TXOutput{balance - amount - fee, script})
+	}
+
+	return ptx, nil
+}
+
+// Sign adds signatures of the wallet to every input locked to one of its keys
+// which doesn't have enough signatures yet, and returns how many it added
+func (ptx *PartialTransaction) Sign(w *Wallet) (int, error) {
+	signed := 0
+
+	for inIdx, prevScript := range ptx.PrevScripts {
+		m, pubKeys, ok := extractMultiSig(prevScript)
+		if !ok || len(ptx.Signatures[inIdx]) >= m {
+			continue
+		}
+
+		for keyIdx, pubKey := range pubKeys {
+			if !bytes.Equal(pubKey, w.PublicKey) {
+				continue
+			}
+			if _, ok := ptx.Signatures[inIdx][keyIdx]; ok {
+				continue
+			}
+
+			signature, err := signHash(&w.PrivateKey, ptx.Tx.SigHash(inIdx, prevScript))
+			if err != nil {
+				return signed, err
+			}
+			ptx.Signatures[inIdx][keyIdx] = signature
+			signed++
+		}
+	}
+
+	return signed, nil
+}
+
+// Status returns the number of signatures the inputs have and need in total
+func (ptx *PartialTransaction) Status() (int, int) {
+	have, need := 0, 0
+	for inIdx, prevScript := range ptx.PrevScripts {
+		m, _, _ := extractMultiSig(prevScript)
+		have += min(len(ptx.Signatures[inIdx]), m)
+		need += m
+	}
+
+	return have, need
+}
+
+// Finalize builds the signed transaction once every input has the signatures it needs.
+// The signatures of an input are pushed in the order of its keys
+func (ptx *PartialTransaction) Finalize() (*Transaction, error) {
+	tx := Transaction{nil, make([]TXInput, len(ptx.Tx.Vin)), ptx.Tx.Vout, ptx.Tx.LockTime}
+
+	for inIdx, prevScript := range ptx.PrevScripts {
+		m, pubKeys, _ := extractMultiSig(prevScript)
+		if len(ptx.Signatures[inIdx]) < m {
+			return nil, ErrMissingSignatures
+		}
+
+		var scriptSig []byte
+		pushed := 0
+		for keyIdx := range pubKeys {
+			signature, ok := ptx.Signatures[inIdx][keyIdx]
+			if !ok || pushed == m {
+				continue
+			}
+			scriptSig = pushData(scriptSig, signature)
+			pushed++
+		}
+		if len(ptx.RedeemScript) > 0 {
+			scriptSig = pushData(scriptSig, ptx.RedeemScript)
+		}
+
+		tx.Vin[inIdx] = ptx.Tx.Vin[inIdx]
+		tx.Vin[inIdx].ScriptSig = scriptSig
+	}
+	tx.SetID()
+
+	return &tx, nil
+}
+
+// Serialize encodes the partial transaction as hex, so it can be passed around as a text file
+func (ptx *PartialTransaction) Serialize() []byte {
+	var buff bytes.Buffer
+
+	err := gob.NewEncoder(&buff).Encode(ptx)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return []byte(hex.EncodeToString(buff.Bytes()))
+}
+
+// DeserializePartialTransaction decodes a partial transaction encoded by Serialize
+func DeserializePartialTransaction(data []byte) (*PartialTransaction, error) {
+	raw, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("decode partial transaction: %w", err)
+	}
+
+	var ptx PartialTransaction
+	err = gob.NewDecoder(bytes.NewReader(raw)).Decode(&ptx)
+	if err != nil {
+		return nil, fmt.Errorf("decode partial transaction: %w", err)
+	}
+	if len(ptx.PrevScripts) != len(ptx.Tx.Vin) || len(ptx.Signatures) != len(ptx.Tx.Vin) {
+		return nil, ErrPartialTransaction
+	}
+	for inIdx := range ptx.Signatures {
+		// Sign adds to the maps, so a file with null maps must not make it panic
+		if ptx.Signatures[inIdx] == nil {
+			ptx.Signatures[inIdx] = make(map[int][]byte)
+		}
+	}
+
+	return &ptx, nil
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// payToAddress mines a block in which the wallet address from pays amount to address to
+func payToAddress(t *testing.T, bc *Blockchain, mp *Mempool, from, to string, amount int) {
+	t.Helper()
+
+	tx, err := NewUTXOTransaction(from, to, amount, 0, 0, &UTXOSet{bc, mp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mp.Add(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, from, mp, 1)
+}
+
+// balanceOf returns the value of unspent outputs locked with script
+func balanceOf(t *testing.T, bc *Blockchain, script []byte) int {
+	t.Helper()
+
+	outs, err := UTXOSet{Blockchain: bc}.FindUTXOs(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balance := 0
+	for _, out := range outs {
+		balance += out.Value
+	}
+
+	return balance
+}
+
+func TestMultiSigSpend(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+	mineBlocks(t, bc, address, mp, bc.params.CoinbaseMaturity)
+
+	keys := newTestWallets(t, 3)
+	multiSig, err := NewMultiSigScript(2, [][]byte{keys[0].PublicKey, keys[1].PublicKey, keys[2].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiSigAddress := bc.params.ScriptAddress(multiSig)
+	payToAddress(t, bc, mp, address, multiSigAddress, 5)
+
+	if _, err := NewMultiSigTransaction(address, address, 3, 1, nil, &UTXOSet{bc, mp}); !errors.Is(err, ErrNotMultiSig) {
+		t.Fatalf("NewMultiSigTransaction from a key address returned %v, want %v", err, ErrNotMultiSig)
+	}
+	ptx, err := NewMultiSigTransaction(multiSigAddress, address, 3, 1, nil, &UTXOSet{bc, mp})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys sign in another order than the script lists them
+	if signed, err := ptx.Sign(keys[2]); err != nil || signed != 1 {
+		t.Fatalf("Sign added %d signatures and returned %v, want 1", signed, err)
+	}
+	if _, err := ptx.Finalize(); !errors.Is(err, ErrMissingSignatures) {
+		t.Fatalf("Finalize with one signature returned %v, want %v", err, ErrMissingSignatures)
+	}
+
+	// Every signer may have its own wallet file, so the transaction is passed on serialized
+	ptx, err = DeserializePartialTransaction(ptx.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed, err := ptx.Sign(keys[0]); err != nil || signed != 1 {
+		t.Fatalf("Sign added %d signatures and returned %v, want 1", signed, err)
+	}
+	if signed, err := ptx.Sign(keys[1]); err != nil || signed != 0 {
+		t.Fatalf("Sign of a complete input added %d signatures and returned %v, want 0", signed, err)
+	}
+	if have, need := ptx.Status(); have != 2 || need != 2 {
+		t.Fatalf("Status is %d of %d signatures, want 2 of 2", have, need)
+	}
+
+	tx, err := ptx.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mp.Add(tx)
+	if err != nil {
+		t.Fatalf("Add of the finalized transaction returned %v", err)
+	}
+	mineBlocks(t, bc, address, mp, 1)
+
+	if balance := balanceOf(t, bc, multiSig); balance != 1 {
+		t.Fatalf("multisig balance is %d, want the change of 1", balance)
+	}
+}
+
+func TestScriptHashSpend(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+	mineBlocks(t, bc, address, mp, bc.params.CoinbaseMaturity)
+
+	keys := newTestWallets(t, 2)
+	redeemScript, err := NewMultiSigScript(2, [][]byte{keys[0].PublicKey, keys[1].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptHashAddress, err := bc.params.ScriptHashAddress(redeemScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payToAddress(t, bc, mp, address, scriptHashAddress, 5)
+
+	otherScript, err := NewMultiSigScript(1, [][]byte{keys[0].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range [][]byte{nil, otherScript} {
+		_, err := NewMultiSigTransaction(scriptHashAddress, address, 3, 1, script, &UTXOSet{bc, mp})
+		if !errors.Is(err, ErrRedeemScriptMismatch) {
+			t.Fatalf("NewMultiSigTransaction with redeem script %x returned %v, want %v", script, err, ErrRedeemScriptMismatch)
+		}
+	}
+
+	ptx, err := NewMultiSigTransaction(scriptHashAddress, address, 3, 1, redeemScript, &UTXOSet{bc, mp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if _, err := ptx.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx, err := ptx.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mp.Add(tx)
+	if err != nil {
+		t.Fatalf("Add of the finalized transaction returned %v", err)
+	}
+	mineBlocks(t, bc, address, mp, 1)
+
+	script, err := bc.params.AddressScript(scriptHashAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := balanceOf(t, bc, script); balance != 1 {
+		t.Fatalf("pay to script hash balance is %d, want the change of 1", balance)
+	}
+}
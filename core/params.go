@@ -0,0 +1,242 @@
+package core
+
+import (
+	"errors"
+	"github.com/btcsuite/btcutil/base58"
+	"math/big"
+)
+
+var ErrWrongNetwork = errors.New("address belongs to another network")
+
+// ChainParams defines the rules and constants of a network.
+// Nodes only accept blocks, transactions and addresses made with the same parameters
+type ChainParams struct {
+	Name string
+
+	// Magic prefixes every network message so nodes of different networks ignore each other
+	Magic          [4]byte
+	DefaultPort    int
+	DefaultRPCPort int
+
+	// AddressVersion is the first byte of base58 encoded addresses
+	AddressVersion byte
+	// MultiSigVersion is the first byte of multisig addresses, which hold the whole locking script
+	MultiSigVersion byte
+	// ScriptHashVersion is the first byte of pay to script hash addresses, which hold the redeem script hash
+	ScriptHashVersion byte
+
+	// GenesisMessage is the coinbase data of the genesis block.
+	// Together with GenesisTime and GenesisNonce it fixes genesis, so every node of the network starts with the same block
+	GenesisMessage string
+	GenesisTime    int32
+	GenesisNonce   uint32
+
+	// Subsidy is the number of new coins a block creates before the first halving.
+	// It is halved every HalvingInterval blocks until it reaches zero
+	Subsidy         int
+	HalvingInterval int
+
+	// CoinbaseMaturity is the number of blocks a coinbase output waits before it can be spent,
+	// so rewards of blocks lost in a reorganization are not spent yet
+	CoinbaseMaturity int
+
+	// PowLimitBits is the number of leading zero bits of the easiest target
+	PowLimitBits     uint
+	TargetBlockTime  int64
+	RetargetInterval int
+	// NoRetargeting keeps every block at the difficulty of genesis
+	NoRetargeting bool
+}
+
+var MainNetParams = ChainParams{
+	Name:              MainNet,
+	Magic:             [4]byte{0xd1, 0x4e, 0xc0, 0x01},
+	DefaultPort:       3000,
+	DefaultRPCPort:    8332,
+	AddressVersion:    0x00,
+	MultiSigVersion:   0x1c,
+	ScriptHashVersion: 0x05,
+	GenesisMessage:    "init base",
+	GenesisTime:       1723723689,
+	GenesisNonce:      58,
+	Subsidy:           10,
+	HalvingInterval:   210000,
+	CoinbaseMaturity:  100,
+	PowLimitBits:      6,
+	TargetBlockTime:   10,
+	RetargetInterval:  10,
+}
+
+var TestNetParams = ChainParams{
+	Name:              TestNet,
+	Magic:             [4]byte{0xd1, 0x4e, 0xc0, 0x02},
+	DefaultPort:       13000,
+	DefaultRPCPort:    18332,
+	AddressVersion:    0x6f,
+	MultiSigVersion:   0x78,
+	ScriptHashVersion: 0xc4,
+	GenesisMessage:    "testnet init base",
+	GenesisTime:       1723723689,
+	GenesisNonce:      33,
+	Subsidy:           10,
+	HalvingInterval:   210000,
+	CoinbaseMaturity:  100,
+	PowLimitBits:      4,
+	TargetBlockTime:   10,
+	RetargetInterval:  10,
+}
+
+// RegTestParams make blocks trivial to mine, so tests can create them on demand
+var RegTestParams = ChainParams{
+	Name:              RegTest,
+	Magic:             [4]byte{0xd1, 0x4e, 0xc0, 0x03},
+	DefaultPort:       23000,
+	DefaultRPCPort:    18443,
+	AddressVersion:    0x3c,
+	MultiSigVersion:   0x41,
+	ScriptHashVersion: 0x3a,
+	GenesisMessage:    "regtest init base",
+	GenesisTime:       1723723689,
+	GenesisNonce:      2,
+	Subsidy:           10,
+	HalvingInterval:   150,
+	CoinbaseMaturity:  2,
+	PowLimitBits:      1,
+	TargetBlockTime:   10,
+	RetargetInterval:  10,
+	NoRetargeting:     true,
+}
+
+// ParamsForNetwork returns the parameters of a network by its name
+func ParamsForNetwork(name string) (*ChainParams, error) {
+	switch name {
+	case MainNet:
+		return &MainNetParams, nil
+	case TestNet:
+		return &TestNetParams, nil
+	case RegTest:
+		return &RegTestParams, nil
+	}
+
+	return nil, ErrUnknownNetwork
+}
+
+// PowLimit is the easiest target a block is allowed to have
+func (p *ChainParams) PowLimit() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), 256-p.PowLimitBits)
+}
+
+// BlockSubsidy returns the number of new coins the block at height may create
+func (p *ChainParams) BlockSubsidy(height int) int {
+	halvings := height / p.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+
+	return p.Subsidy >> halvings
+}
+
+// IssuedSupply returns the number of coins created by blocks up to height
+// if every block claimed its full subsidy
+func (p *ChainParams) IssuedSupply(height int) int {
+	supply := 0
+	for start := 0; start <= height; start += p.HalvingInterval {
+		subsidy := p.BlockSubsidy(start)
+		if subsidy == 0 {
+			break
+		}
+
+		blocks := p.HalvingInterval
+		if height-start+1 < blocks {
+			blocks = height - start + 1
+		}
+		supply += subsidy * blocks
+	}
+
+	return supply
+}
+
+// MaxSupply returns the number of coins in existence once the subsidy reaches zero
+func (p *ChainParams) MaxSupply() int {
+	supply := 0
+	for subsidy := p.Subsidy; subsidy > 0; subsidy >>= 1 {
+		supply += subsidy * p.HalvingInterval
+	}
+
+	return supply
+}
+
+// EncodeAddress makes an address of the network from a public key hash
+func (p *ChainParams) EncodeAddress(pubKeyHash []byte) string {
+	return base58.CheckEncode(pubKeyHash, p.AddressVersion)
+}
+
+// DecodeAddress returns the public key hash of an address of the network
+func (p *ChainParams) DecodeAddress(address string) ([]byte, error) {
+	pubKeyHash, version, err := base58.CheckDecode(address)
+	if err != nil {
+		return nil, ErrInvalidAddress
+	}
+	if version != p.AddressVersion {
+		return nil, ErrWrongNetwork
+	}
+
+	return pubKeyHash, nil
+}
+
+// AddressScript returns the script locking outputs to an address of the network.
+// It is a pay to public key hash script, a pay to script hash script or,
+// for multisig addresses, the multisig script
+func (p *ChainParams) AddressScript(address string) ([]byte, error) {
+	payload, version, err := base58.CheckDecode(address)
+	if err != nil {
+		return nil, ErrInvalidAddress
+	}
+
+	switch version {
+	case p.AddressVersion:
+		if len(payload) != 20 {
+			return nil, ErrInvalidAddress
+		}
+		return payToPubKeyHashScript(payload), nil
+	case p.ScriptHashVersion:
+		if len(payload) != 20 {
+			return nil, ErrInvalidAddress
+		}
+		return payToScriptHashScript(payload), nil
+	case p.MultiSigVersion:
+		if classifyScript(payload) != multiSigScript {
+			return nil, ErrInvalidAddress
+		}
+		return payload, nil
+	}
+
+	return nil, ErrWrongNetwork
+}
+
+// ScriptAddress returns the address of the network a locking script pays to.
+// Non-standard scripts have no address
+func (p *ChainParams) ScriptAddress(script []byte) string {
+	switch classifyScript(script) {
+	case pubKeyHashScript:
+		publicKeyHash, _ := extractPubKeyHash(script)
+		return p.EncodeAddress(publicKeyHash)
+	case multiSigScript:
+		return base58.CheckEncode(script, p.MultiSigVersion)
+	case scriptHashScript:
+		scriptHash, _ := extractScriptHash(script)
+		return base58.CheckEncode(scriptHash, p.ScriptHashVersion)
+	}
+
+	return ""
+}
+
+// ScriptHashAddress returns the pay to script hash address of a redeem script.
+// Senders only need the address, while spenders reveal the redeem script
+func (p *ChainParams) ScriptHashAddress(redeemScript []byte) (string, error) {
+	if len(redeemScript) > maxPushSize {
+		return "", ErrRedeemScriptTooLarge
+	}
+
+	return p.ScriptAddress(payToScriptHashScript(HashPublicKey(redeemScript))), nil
+}
@@ -1,77 +1,138 @@
 package core
 
 import (
-	"blockchain/util"
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
-	"fmt"
+	"errors"
 	"log"
 	"math"
 	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type ProofOfWork struct {
-	block  *Block
+	header *BlockHeader
 	target *big.Int
 }
 
-// TargetBits is difficulty to mine a Block in POW
-const TargetBits = 6
-const MaxNonce = math.MaxInt
+// MaxNonce is the last nonce tried for one coinbase.
+// When the range is exhausted, the miner changes the extra nonce of the coinbase and starts over
+const MaxNonce = math.MaxUint32
 
-// NewProofOfWork builds a new ProofOfWork
-func NewProofOfWork(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-TargetBits))
-	return &ProofOfWork{b, target}
-}
+// hashRateInterval is how often Run reports the hash rate
+const hashRateInterval = time.Second
+
+// cancelCheckInterval is how many hashes a worker calculates between checks of its context
+const cancelCheckInterval = 256
+
+var ErrNonceExhausted = errors.New("nonce range is exhausted")
+
+// HashRateFunc receives the number of hashes calculated per second while mining
+type HashRateFunc func(hashesPerSecond float64)
 
-// prepareData prepares Data to calculate Hash in order to get Nonce
-func (pow *ProofOfWork) prepareData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			[]byte(pow.block.PrevHash),
-			pow.block.HashTransactions(),
-			util.IntToHex(int64(pow.block.TimeStamp)),
-			util.IntToHex(int64(TargetBits)),
-			util.IntToHex(int64(nonce)),
-		},
-		[]byte{},
-	)
-	return data
+// NewProofOfWork builds a new ProofOfWork with the target in header bits
+func NewProofOfWork(h *BlockHeader) *ProofOfWork {
+	target := CompactToBig(h.Bits)
+	return &ProofOfWork{h, target}
 }
 
-// Run compares target and hashed data and mine block.
-// If calculated hash is smaller than target, the process terminates
-func (pow *ProofOfWork) Run() (int, []byte) {
-	var hashInt big.Int
-	var hash [32]byte
-	nonce := 0
-	for nonce < MaxNonce {
-		data := pow.prepareData(nonce)
-		hash = sha256.Sum256(data)
-		fmt.Printf("\r%x", hash)
-
-		hashInt.SetBytes(hash[:])
-		if hashInt.Cmp(pow.target) == -1 {
-			fmt.Println()
-			break
-		} else {
-			nonce++
+// Run searches a nonce whose hash is smaller than target.
+// The nonce range is split across GOMAXPROCS workers, which stop as soon as one of them
+// finds a nonce or ctx is done. report, if not nil, gets the hash rate every hashRateInterval
+func (pow *ProofOfWork) Run(ctx context.Context, report HashRateFunc) (uint32, []byte, error) {
+	type result struct {
+		nonce uint32
+		hash  []byte
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := runtime.GOMAXPROCS(0)
+	found := make(chan result, workers)
+	var hashes atomic.Uint64
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(first uint64) {
+			defer wg.Done()
+
+			// Only the nonce changes between tries, so it is written into the serialized header in place
+			data := pow.header.Serialize()
+			nonceBytes := data[nonceOffset : nonceOffset+4]
+			var hashInt big.Int
+			counted := 0
+			// The counter is wider than the nonce, so it can pass MaxNonce and end the loop
+			for nonce := first; nonce <= MaxNonce; nonce += uint64(workers) {
+				counted++
+				if counted == cancelCheckInterval {
+					hashes.Add(uint64(counted))
+					counted = 0
+					if ctx.Err() != nil {
+						return
+					}
+				}
+
+				binary.LittleEndian.PutUint32(nonceBytes, uint32(nonce))
+				hash := sha256.Sum256(data)
+				hashInt.SetBytes(hash[:])
+				if hashInt.Cmp(pow.target) == -1 {
+					found <- result{uint32(nonce), hash[:]}
+					cancel()
+					return
+				}
+			}
+		}(uint64(w))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(hashRateInterval)
+	defer ticker.Stop()
+	start := time.Now()
+
+	for {
+		select {
+		case <-done:
+			select {
+			case r := <-found:
+				return r.nonce, r.hash, nil
+			default:
+			}
+			if err := ctx.Err(); err != nil {
+				// No worker found a nonce, so ctx was canceled by the caller
+				return 0, nil, err
+			}
+			return 0, nil, ErrNonceExhausted
+		case <-ticker.C:
+			if report != nil {
+				report(float64(hashes.Load()) / time.Since(start).Seconds())
+			}
 		}
 	}
-	return nonce, hash[:]
 }
 
-// Validate checks if certain block is mined through POW or not
+// Validate checks if certain header is mined through POW or not.
+// Whether the target itself is allowed is checked against the chain difficulty
 func (pow *ProofOfWork) Validate() bool {
 	var hashInt big.Int
 
-	hash := sha256.Sum256(
-		pow.prepareData(pow.block.Nonce),
-	)
-	hashInt.SetBytes(hash[:])
+	if pow.target.Sign() <= 0 {
+		return false
+	}
+
+	hashInt.SetBytes(pow.header.Hash())
 
 	isValid := hashInt.Cmp(pow.target) == -1
 	return isValid
@@ -89,12 +150,19 @@ func (tx Transaction) Serialize() []byte {
 	return writer.Bytes()
 }
 
+// Size returns the number of bytes of the serialized transaction
+func (tx Transaction) Size() int {
+	return len(tx.Serialize())
+}
+
 // HashTransactions hashes transactions
+// Transaction IDs are used as leaves. They hash transactions in a fixed binary format,
+// unlike gob output, which depends on the order types were registered in a process
 func (b *Block) HashTransactions() []byte {
 	var transactions [][]byte
 
 	for _, tx := range b.Transactions {
-		transactions = append(transactions, tx.Serialize())
+		transactions = append(transactions, tx.ID)
 	}
 	mTree := NewMerkleTree(transactions)
 
@@ -0,0 +1,756 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Opcodes of the script language. Bytes 0x01 to 0x4b push that many following bytes
+const (
+	op0                   = 0x00
+	opPushData1           = 0x4c
+	opPushData2           = 0x4d
+	op1                   = 0x51
+	op16                  = 0x60
+	opVerify              = 0x69
+	opReturn              = 0x6a
+	opDrop                = 0x75
+	opDup                 = 0x76
+	opEqual               = 0x87
+	opEqualVerify         = 0x88
+	opHash160             = 0xa9
+	opCheckSig            = 0xac
+	opCheckSigVerify      = 0xad
+	opCheckMultiSig       = 0xae
+	opCheckMultiSigVerify = 0xaf
+	opCheckLockTimeVerify = 0xb1
+)
+
+var opNames = map[byte]string{
+	op0:                   "OP_0",
+	opVerify:              "OP_VERIFY",
+	opReturn:              "OP_RETURN",
+	opDrop:                "OP_DROP",
+	opDup:                 "OP_DUP",
+	opEqual:               "OP_EQUAL",
+	opEqualVerify:         "OP_EQUALVERIFY",
+	opHash160:             "OP_HASH160",
+	opCheckSig:            "OP_CHECKSIG",
+	opCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	opCheckMultiSig:       "OP_CHECKMULTISIG",
+	opCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+	opCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+}
+
+// Limits keep evaluation of a script cheap
+const (
+	maxScriptSize   = 10000
+	maxPushSize     = 520
+	maxStackSize    = 1000
+	maxMultiSigKeys = 20
+	// Standard multisig scripts count keys with OP_1 to OP_16
+	maxStandardMultiSigKeys = 16
+	maxScriptNumSize        = 5
+)
+
+// MaxDataSize is the number of bytes a standard data output carries at most
+const MaxDataSize = 80
+
+var (
+	ErrInvalidScript        = errors.New("script is malformed")
+	ErrScriptFailed         = errors.New("script of the spent output is not satisfied")
+	ErrUnspendable          = errors.New("output is unspendable")
+	ErrLockTimeNotReached   = errors.New("lock time of the transaction doesn't satisfy the lock of the spent output")
+	ErrNonStandard          = errors.New("transaction has a non-standard script")
+	ErrInvalidMultiSig      = errors.New("multisig needs 1 <= M <= N <= 16 public keys")
+	ErrRedeemScriptMismatch = errors.New("redeem script does not match the script hash of the spent output")
+	ErrRedeemScriptTooLarge = errors.New("redeem script is too large to be pushed by an input")
+)
+
+// scriptOp is a parsed instruction of a script. data is set for pushes
+type scriptOp struct {
+	code byte
+	data []byte
+}
+
+// isPush tells whether the instruction only pushes data
+func (op scriptOp) isPush() bool {
+	return op.code <= opPushData2 || (op.code >= op1 && op.code <= op16)
+}
+
+// isMinimalPush tells whether the instruction pushes data with its shortest encoding.
+// A number 1 to 16 is pushed with OP_1 to OP_16
+func (op scriptOp) isMinimalPush() bool {
+	switch {
+	case !op.isPush():
+		return false
+	case op.code == op0 || op.code >= op1:
+		return true
+	case len(op.data) == 0:
+		return false
+	case len(op.data) == 1 && op.data[0] >= 1 && op.data[0] <= 16:
+		return false
+	}
+
+	return op.code == pushData(nil, op.data)[0]
+}
+
+// parseScript splits a script into instructions
+func parseScript(script []byte) ([]scriptOp, error) {
+	if len(script) > maxScriptSize {
+		return nil, ErrInvalidScript
+	}
+
+	var ops []scriptOp
+	for i := 0; i < len(script); {
+		code := script[i]
+		i++
+
+		size := 0
+		switch {
+		case code == op0 || code > opPushData2:
+			ops = append(ops, scriptOp{code: code})
+			continue
+		case code < opPushData1:
+			size = int(code)
+		case code == opPushData1:
+			if i+1 > len(script) {
+				return nil, ErrInvalidScript
+			}
+			size = int(script[i])
+			i++
+		case code == opPushData2:
+			if i+2 > len(script) {
+				return nil, ErrInvalidScript
+			}
+			size = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		}
+
+		if size > maxPushSize || i+size > len(script) {
+			return nil, ErrInvalidScript
+		}
+		ops = append(ops, scriptOp{code, script[i : i+size]})
+		i += size
+	}
+
+	return ops, nil
+}
+
+// pushData appends an instruction pushing data to script
+func pushData(script, data []byte) []byte {
+	switch n := len(data); {
+	case n == 0:
+		return append(script, op0)
+	case n < opPushData1:
+		script = append(script, byte(n))
+	case n <= 0xff:
+		script = append(script, opPushData1, byte(n))
+	default:
+		script = append(script, opPushData2)
+		script = binary.LittleEndian.AppendUint16(script, uint16(n))
+	}
+
+	return append(script, data...)
+}
+
+// pushInt appends an instruction pushing a number to script
+func pushInt(script []byte, n int64) []byte {
+	if n == 0 {
+		return append(script, op0)
+	}
+	if n >= 1 && n <= 16 {
+		return append(script, byte(op1+n-1))
+	}
+
+	return pushData(script, encodeScriptNum(n))
+}
+
+// encodeScriptNum encodes a number as little endian magnitude with the sign in the highest bit
+func encodeScriptNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	var data []byte
+	for ; n > 0; n >>= 8 {
+		data = append(data, byte(n))
+	}
+
+	// The sign needs its own byte if the highest bit is taken
+	if data[len(data)-1]&0x80 != 0 {
+		data = append(data, 0)
+	}
+	if negative {
+		data[len(data)-1] |= 0x80
+	}
+
+	return data
+}
+
+// decodeScriptNum decodes a number of at most maxSize bytes encoded by encodeScriptNum
+func decodeScriptNum(data []byte, maxSize int) (int64, error) {
+	if len(data) > maxSize {
+		return 0, ErrInvalidScript
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * i)
+	}
+	if data[len(data)-1]&0x80 != 0 {
+		n &^= int64(0x80) << (8 * (len(data) - 1))
+		n = -n
+	}
+
+	return n, nil
+}
+
+// asBool is false for empty data and any form of zero
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			// Negative zero
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+
+	return false
+}
+
+func boolData(value bool) []byte {
+	if value {
+		return []byte{1}
+	}
+
+	return nil
+}
+
+// interpreter evaluates the scripts of input inIdx of tx
+type interpreter struct {
+	tx    *Transaction
+	inIdx int
+	stack [][]byte
+}
+
+// verifyScript checks scriptSig of input inIdx of tx satisfies scriptPubKey of the output it spends.
+// scriptSig may only push data. Its stack is the start stack of scriptPubKey,
+// which must leave a true value on top.
+// A pay to script hash output is satisfied by a scriptSig whose last push is the redeem script
+// with the hash of the output. The other pushes are then the start stack of the redeem script
+func verifyScript(scriptSig, scriptPubKey []byte, tx *Transaction, inIdx int) error {
+	vm, err := evalScript(scriptSig, scriptPubKey, tx, inIdx)
+	if err != nil {
+		return err
+	}
+
+	if len(vm.stack) == 0 || !asBool(vm.stack[len(vm.stack)-1]) {
+		return ErrScriptFailed
+	}
+
+	return nil
+}
+
+// evalScript runs scriptSig and scriptPubKey as verifyScript does and returns the interpreter with the stack they leave
+func evalScript(scriptSig, scriptPubKey []byte, tx *Transaction, inIdx int) (*interpreter, error) {
+	sigOps, err := parseScript(scriptSig)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range sigOps {
+		if !op.isPush() {
+			return nil, ErrInvalidScript
+		}
+	}
+
+	vm := &interpreter{tx: tx, inIdx: inIdx}
+	err = vm.execute(sigOps, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	script := scriptPubKey
+	if scriptHash, ok := extractScriptHash(scriptPubKey); ok {
+		// The redeem script is checked against the hash before any of it runs
+		script, err = vm.pop()
+		if err != nil {
+			return nil, ErrScriptFailed
+		}
+		if !bytes.Equal(HashPublicKey(script), scriptHash) {
+			return nil, ErrRedeemScriptMismatch
+		}
+	}
+
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil, err
+	}
+	err = vm.execute(ops, script)
+	if err != nil {
+		return nil, err
+	}
+
+	return vm, nil
+}
+
+func (vm *interpreter) push(data []byte) error {
+	if len(vm.stack) >= maxStackSize {
+		return ErrInvalidScript
+	}
+	vm.stack = append(vm.stack, data)
+
+	return nil
+}
+
+func (vm *interpreter) pop() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, ErrInvalidScript
+	}
+	data := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+
+	return data, nil
+}
+
+func (vm *interpreter) popInt() (int64, error) {
+	data, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeScriptNum(data, 4)
+}
+
+// execute runs instructions on the stack. subscript is the script whose signatures are checked
+func (vm *interpreter) execute(ops []scriptOp, subscript []byte) error {
+	for _, op := range ops {
+		if op.isPush() {
+			data := op.data
+			if op.code >= op1 {
+				data = encodeScriptNum(int64(op.code - op1 + 1))
+			}
+			if err := vm.push(data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch op.code {
+		case opVerify:
+			value, err := vm.pop()
+			if err != nil {
+				return err
+			}
+			if !asBool(value) {
+				return ErrScriptFailed
+			}
+
+		case opReturn:
+			return ErrUnspendable
+
+		case opDrop:
+			if _, err := vm.pop(); err != nil {
+				return err
+			}
+
+		case opDup:
+			if len(vm.stack) == 0 {
+				return ErrInvalidScript
+			}
+			if err := vm.push(vm.stack[len(vm.stack)-1]); err != nil {
+				return err
+			}
+
+		case opEqual, opEqualVerify:
+			a, err := vm.pop()
+			if err != nil {
+				return err
+			}
+			b, err := vm.pop()
+			if err != nil {
+				return err
+			}
+			equal := bytes.Equal(a, b)
+			if op.code == opEqualVerify {
+				if !equal {
+					return ErrScriptFailed
+				}
+				continue
+			}
+			if err := vm.push(boolData(equal)); err != nil {
+				return err
+			}
+
+		case opHash160:
+			data, err := vm.pop()
+			if err != nil {
+				return err
+			}
+			if err := vm.push(HashPublicKey(data)); err != nil {
+				return err
+			}
+
+		case opCheckSig, opCheckSigVerify:
+			pubKey, err := vm.pop()
+			if err != nil {
+				return err
+			}
+			signature, err := vm.pop()
+			if err != nil {
+				return err
+			}
+			valid := vm.checkSig(signature, pubKey, subscript)
+			if op.code == opCheckSigVerify {
+				if !valid {
+					return ErrBadSignature
+				}
+				continue
+			}
+			if err := vm.push(boolData(valid)); err != nil {
+				return err
+			}
+
+		case opCheckMultiSig, opCheckMultiSigVerify:
+			valid, err := vm.checkMultiSig(subscript)
+			if err != nil {
+				return err
+			}
+			if op.code == opCheckMultiSigVerify {
+				if !valid {
+					return ErrBadSignature
+				}
+				continue
+			}
+			if err := vm.push(boolData(valid)); err != nil {
+				return err
+			}
+
+		case opCheckLockTimeVerify:
+			// The lock stays on the stack, so scripts drop it afterwards
+			if len(vm.stack) == 0 {
+				return ErrInvalidScript
+			}
+			lockTime, err := decodeScriptNum(vm.stack[len(vm.stack)-1], maxScriptNumSize)
+			if err != nil {
+				return err
+			}
+			if lockTime < 0 {
+				return ErrInvalidScript
+			}
+			if !vm.checkLockTime(lockTime) {
+				return ErrLockTimeNotReached
+			}
+
+		default:
+			return ErrInvalidScript
+		}
+	}
+
+	return nil
+}
+
+// checkLockTime checks the transaction can't be mined before lockTime.
+// The lock time of the transaction has to be of the same kind and at least lockTime,
+// and the input must not be final, as lock times of transactions with only final inputs are not enforced
+func (vm *interpreter) checkLockTime(lockTime int64) bool {
+	txLockTime := int64(vm.tx.LockTime)
+	if (lockTime < LockTimeThreshold) != (txLockTime < LockTimeThreshold) {
+		return false
+	}
+
+	return lockTime <= txLockTime && vm.tx.Vin[vm.inIdx].Sequence != SequenceFinal
+}
+
+// checkSig verifies a signature of the input over the transaction with subscript as the spent script
+func (vm *interpreter) checkSig(signature, pubKey, subscript []byte) bool {
+	key, err := parsePublicKey(pubKey)
+	if err != nil {
+		return false
+	}
+
+	return verifySignature(key, vm.tx.SigHash(vm.inIdx, subscript), signature)
+}
+
+// checkMultiSig pops N public keys, M signatures and their counts and checks
+// the signatures match M of the keys in the same order
+func (vm *interpreter) checkMultiSig(subscript []byte) (bool, error) {
+	keyCount, err := vm.popInt()
+	if err != nil {
+		return false, err
+	}
+	if keyCount < 0 || keyCount > maxMultiSigKeys {
+		return false, ErrInvalidScript
+	}
+	pubKeys := make([][]byte, keyCount)
+	for i := keyCount - 1; i >= 0; i-- {
+		pubKeys[i], err = vm.pop()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	sigCount, err := vm.popInt()
+	if err != nil {
+		return false, err
+	}
+	if sigCount < 0 || sigCount > keyCount {
+		return false, ErrInvalidScript
+	}
+	signatures := make([][]byte, sigCount)
+	for i := sigCount - 1; i >= 0; i-- {
+		signatures[i], err = vm.pop()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Every signature has to match a later key than the one before it
+	key := 0
+	for _, signature := range signatures {
+		for key < len(pubKeys) && !vm.checkSig(signature, pubKeys[key], subscript) {
+			key++
+		}
+		if key == len(pubKeys) {
+			return false, nil
+		}
+		key++
+	}
+
+	return true, nil
+}
+
+// scriptClass is the kind of a standard script
+type scriptClass int
+
+const (
+	nonStandardScript scriptClass = iota
+	pubKeyHashScript
+	multiSigScript
+	scriptHashScript
+	nullDataScript
+)
+
+// payToPubKeyHashScript locks an output to the key whose hash is pubKeyHash:
+// OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func payToPubKeyHashScript(pubKeyHash []byte) []byte {
+	script := []byte{opDup, opHash160}
+	script = pushData(script, pubKeyHash)
+
+	return append(script, opEqualVerify, opCheckSig)
+}
+
+// payToScriptHashScript locks an output to the redeem script whose hash is scriptHash:
+// OP_HASH160 <scriptHash> OP_EQUAL
+func payToScriptHashScript(scriptHash []byte) []byte {
+	script := []byte{opHash160}
+	script = pushData(script, scriptHash)
+
+	return append(script, opEqual)
+}
+
+// nullDataOutputScript makes an output carrying data which can't be spent: OP_RETURN <data>
+func nullDataOutputScript(data []byte) []byte {
+	return pushData([]byte{opReturn}, data)
+}
+
+// isUnspendable tells whether no input can satisfy a script, so its output can be left out of the UTXO set
+func isUnspendable(script []byte) bool {
+	return len(script) > 0 && script[0] == opReturn
+}
+
+// NewMultiSigScript locks an output to m signatures of the n public keys:
+// OP_m <pubKey 1> ... <pubKey n> OP_n OP_CHECKMULTISIG.
+// Signatures have to be given in the order of the keys
+func NewMultiSigScript(m int, pubKeys [][]byte) ([]byte, error) {
+	if m < 1 || m > len(pubKeys) || len(pubKeys) > maxStandardMultiSigKeys {
+		return nil, ErrInvalidMultiSig
+	}
+
+	script := pushInt(nil, int64(m))
+	for _, pubKey := range pubKeys {
+		if _, err := parsePublicKey(pubKey); err != nil {
+			return nil, err
+		}
+		script = pushData(script, pubKey)
+	}
+	script = pushInt(script, int64(len(pubKeys)))
+
+	return append(script, opCheckMultiSig), nil
+}
+
+// extractMultiSig returns the number of required signatures and the public keys of a multisig script
+func extractMultiSig(script []byte) (int, [][]byte, bool) {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) < 4 || ops[len(ops)-1].code != opCheckMultiSig {
+		return 0, nil, false
+	}
+
+	m, mOK := smallInt(ops[0])
+	n, nOK := smallInt(ops[len(ops)-2])
+	keyOps := ops[1 : len(ops)-2]
+	if !mOK || !nOK || m < 1 || m > n || n != len(keyOps) {
+		return 0, nil, false
+	}
+
+	var pubKeys [][]byte
+	for _, op := range keyOps {
+		if op.code != byte(len(op.data)) || len(op.data) != 2*coordinateSize {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, op.data)
+	}
+
+	return m, pubKeys, true
+}
+
+// smallInt returns the number an OP_1 to OP_16 instruction pushes
+func smallInt(op scriptOp) (int, bool) {
+	if op.code < op1 || op.code > op16 {
+		return 0, false
+	}
+
+	return int(op.code-op1) + 1, true
+}
+
+// classifyScript tells which standard template a script follows
+func classifyScript(script []byte) scriptClass {
+	if _, ok := extractPubKeyHash(script); ok {
+		return pubKeyHashScript
+	}
+	if _, _, ok := extractMultiSig(script); ok {
+		return multiSigScript
+	}
+	if _, ok := extractScriptHash(script); ok {
+		return scriptHashScript
+	}
+	if _, ok := extractData(script); ok {
+		return nullDataScript
+	}
+
+	return nonStandardScript
+}
+
+// extractPubKeyHash returns the public key hash a pay to public key hash script locks to
+func extractPubKeyHash(script []byte) ([]byte, bool) {
+	if len(script) != 25 || script[0] != opDup || script[1] != opHash160 || script[2] != 20 ||
+		script[23] != opEqualVerify || script[24] != opCheckSig {
+		return nil, false
+	}
+
+	return script[3:23], true
+}
+
+// extractScriptHash returns the redeem script hash a pay to script hash script locks to
+func extractScriptHash(script []byte) ([]byte, bool) {
+	if len(script) != 23 || script[0] != opHash160 || script[1] != 20 || script[22] != opEqual {
+		return nil, false
+	}
+
+	return script[2:22], true
+}
+
+// extractData returns the data of a standard data output script, which pushes at most MaxDataSize bytes
+func extractData(script []byte) ([]byte, bool) {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) == 0 || len(ops) > 2 || ops[0].code != opReturn {
+		return nil, false
+	}
+	if len(ops) == 1 {
+		return nil, true
+	}
+	if ops[1].code > opPushData2 || len(ops[1].data) > MaxDataSize {
+		return nil, false
+	}
+
+	return ops[1].data, true
+}
+
+// checkStandard rejects transactions whose scripts this node doesn't relay or mine,
+// although a block containing them would be valid.
+// Signatures don't cover scriptSig, so it may only push data in the shortest way.
+// Otherwise anyone relaying the transaction could encode it differently and change its ID
+func (tx *Transaction) checkStandard() error {
+	for _, vin := range tx.Vin {
+		ops, err := parseScript(vin.ScriptSig)
+		if err != nil {
+			return ErrNonStandard
+		}
+		for _, op := range ops {
+			if !op.isMinimalPush() {
+				return ErrNonStandard
+			}
+		}
+	}
+
+	// A transaction carries data in one output, which burns no coins
+	dataOutputs := 0
+	for _, out := range tx.Vout {
+		switch classifyScript(out.ScriptPubKey) {
+		case nonStandardScript:
+			return ErrNonStandard
+		case nullDataScript:
+			dataOutputs++
+			if dataOutputs > 1 || out.Value != 0 {
+				return ErrNonStandard
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkCleanStack rejects inputs whose scripts leave more than the result on the stack.
+// Extra pushes in scriptSig would change the transaction ID without making it invalid
+func (v *utxoView) checkCleanStack(tx *Transaction) error {
+	for inIdx, vin := range tx.Vin {
+		out, ok := v.output(hex.EncodeToString(vin.Txid), vin.TxoutIdx)
+		if !ok {
+			return ErrMissingInput
+		}
+
+		vm, err := evalScript(vin.ScriptSig, out.ScriptPubKey, tx, inIdx)
+		if err != nil {
+			return err
+		}
+		if len(vm.stack) != 1 {
+			return fmt.Errorf("input %d: %w", inIdx, ErrNonStandard)
+		}
+	}
+
+	return nil
+}
+
+// DisasmScript returns a readable form of a script. Pushed data is written in hex
+func DisasmScript(script []byte) string {
+	ops, err := parseScript(script)
+	if err != nil {
+		return "[invalid script]"
+	}
+
+	var words []string
+	for _, op := range ops {
+		switch {
+		case op.code >= op1 && op.code <= op16:
+			words = append(words, fmt.Sprintf("OP_%d", op.code-op1+1))
+		case op.code != op0 && op.code <= opPushData2:
+			words = append(words, hex.EncodeToString(op.data))
+		case opNames[op.code] != "":
+			words = append(words, opNames[op.code])
+		default:
+			words = append(words, fmt.Sprintf("OP_UNKNOWN_%02x", op.code))
+		}
+	}
+
+	return strings.Join(words, " ")
+}
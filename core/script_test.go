@@ -0,0 +1,195 @@
+package core
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// newScriptTestTx returns a transaction with one input whose scripts the tests evaluate
+func newScriptTestTx() *Transaction {
+	return &Transaction{
+		Vin:  []TXInput{{make([]byte, 32), 0, nil, 0}},
+		Vout: []TXOutput{{1, []byte{opReturn}}},
+	}
+}
+
+// newTestWallets returns n new wallets
+func newTestWallets(t *testing.T, n int) []*Wallet {
+	t.Helper()
+
+	var wallets []*Wallet
+	for i := 0; i < n; i++ {
+		w, err := NewWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wallets = append(wallets, w)
+	}
+
+	return wallets
+}
+
+// signInput signs the input of tx with the key of w and subscript as the spent script
+func signInput(t *testing.T, tx *Transaction, w *Wallet, subscript []byte) []byte {
+	t.Helper()
+
+	signature, err := signHash(&w.PrivateKey, tx.SigHash(0, subscript))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signature
+}
+
+// highS returns signature with s replaced by N-s, which is valid ECDSA but not accepted
+func highS(signature []byte) []byte {
+	var s big.Int
+	s.SetBytes(signature[coordinateSize:])
+	s.Sub(elliptic.P256().Params().N, &s)
+
+	high := append([]byte{}, signature[:coordinateSize]...)
+	return append(high, s.FillBytes(make([]byte, coordinateSize))...)
+}
+
+// pushAll makes a script pushing every item
+func pushAll(items ...[]byte) []byte {
+	var script []byte
+	for _, item := range items {
+		script = pushData(script, item)
+	}
+
+	return script
+}
+
+func TestVerifyScript(t *testing.T) {
+	tx := newScriptTestTx()
+	keys := newTestWallets(t, 3)
+	pubKeys := [][]byte{keys[0].PublicKey, keys[1].PublicKey, keys[2].PublicKey}
+
+	p2pkh := payToPubKeyHashScript(HashPublicKey(keys[0].PublicKey))
+	multiSig, err := NewMultiSigScript(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2sh := payToScriptHashScript(HashPublicKey(multiSig))
+
+	sig0 := signInput(t, tx, keys[0], p2pkh)
+	otherSig := signInput(t, tx, keys[1], p2pkh)
+	multiSig0 := signInput(t, tx, keys[0], multiSig)
+	multiSig2 := signInput(t, tx, keys[2], multiSig)
+
+	tests := []struct {
+		name         string
+		scriptSig    []byte
+		scriptPubKey []byte
+		want         error
+	}{
+		{"pay to public key hash", pushAll(sig0, keys[0].PublicKey), p2pkh, nil},
+		{"key of another hash", pushAll(otherSig, keys[1].PublicKey), p2pkh, ErrScriptFailed},
+		{"signature of another key", pushAll(otherSig, keys[0].PublicKey), p2pkh, ErrScriptFailed},
+		{"high s signature", pushAll(highS(sig0), keys[0].PublicKey), p2pkh, ErrScriptFailed},
+		{"no signature", nil, p2pkh, ErrInvalidScript},
+		{"scriptSig which doesn't only push", []byte{op1, opDup}, []byte{opDrop}, ErrInvalidScript},
+		{"malformed push", nil, []byte{5, 1}, ErrInvalidScript},
+		{"unknown opcode", nil, []byte{op1, 0xff}, ErrInvalidScript},
+		{"OP_RETURN", []byte{op1}, nullDataOutputScript([]byte("data")), ErrUnspendable},
+		{"OP_VERIFY true", []byte{op1}, []byte{opVerify, op1}, nil},
+		{"OP_VERIFY false", []byte{op0}, []byte{opVerify, op1}, ErrScriptFailed},
+		{"OP_DROP", pushAll([]byte{1}, nil), []byte{opDrop}, nil},
+		{"empty stack", []byte{op1}, []byte{opDrop}, ErrScriptFailed},
+		{"false on top", []byte{op0}, nil, ErrScriptFailed},
+		{"negative zero is false", pushAll([]byte{0x80}), nil, ErrScriptFailed},
+		{"OP_DUP OP_EQUAL", pushAll([]byte("a")), []byte{opDup, opEqual}, nil},
+		{"OP_EQUAL", pushAll([]byte("a")), append(pushAll([]byte("b")), opEqual), ErrScriptFailed},
+		{"OP_EQUALVERIFY", pushAll([]byte("a")), append(pushAll([]byte("b")), opEqualVerify, op1), ErrScriptFailed},
+		{"OP_HASH160", pushAll([]byte("a")), append(append([]byte{opHash160}, pushAll(HashPublicKey([]byte("a")))...), opEqualVerify, op1), nil},
+		{"OP_CHECKSIGVERIFY", pushAll(otherSig, keys[0].PublicKey), append(append([]byte{}, p2pkh[:24]...), opCheckSigVerify, op1), ErrBadSignature},
+		{"multisig", pushAll(multiSig0, multiSig2), multiSig, nil},
+		{"multisig signatures out of order", pushAll(multiSig2, multiSig0), multiSig, ErrScriptFailed},
+		{"multisig with one signature twice", pushAll(multiSig0, multiSig0), multiSig, ErrScriptFailed},
+		{"multisig with too few signatures", pushAll(multiSig0), multiSig, ErrInvalidScript},
+		{"OP_CHECKMULTISIGVERIFY", pushAll(multiSig2, multiSig0), append(append([]byte{}, multiSig[:len(multiSig)-1]...), opCheckMultiSigVerify, op1), ErrBadSignature},
+		{"pay to script hash", pushAll(multiSig0, multiSig2, multiSig), p2sh, nil},
+		{"redeem script of another hash", pushAll(sig0, keys[0].PublicKey, p2pkh), p2sh, ErrRedeemScriptMismatch},
+		{"pay to script hash without redeem script", nil, p2sh, ErrScriptFailed},
+		{"redeem script which fails", pushAll(multiSig0, multiSig), p2sh, ErrInvalidScript},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyScript(tt.scriptSig, tt.scriptPubKey, tx, 0)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("verifyScript returned %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLockTimeVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		lock     int64
+		lockTime uint32
+		sequence uint32
+		want     error
+	}{
+		{"height reached", 10, 10, 0, nil},
+		{"later height", 10, 20, 0, nil},
+		{"height not reached", 10, 9, 0, ErrLockTimeNotReached},
+		{"time reached", LockTimeThreshold + 10, LockTimeThreshold + 10, 0, nil},
+		{"time not reached", LockTimeThreshold + 10, LockTimeThreshold + 9, 0, ErrLockTimeNotReached},
+		{"height against time", 10, LockTimeThreshold, 0, ErrLockTimeNotReached},
+		{"time against height", LockTimeThreshold, 10, 0, ErrLockTimeNotReached},
+		{"final input", 10, 10, SequenceFinal, ErrLockTimeNotReached},
+		{"relative lock of the input", 10, 10, 5, nil},
+		{"negative lock", -1, 10, 0, ErrInvalidScript},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := newScriptTestTx()
+			tx.LockTime = tt.lockTime
+			tx.Vin[0].Sequence = tt.sequence
+			script := append(pushInt(nil, tt.lock), opCheckLockTimeVerify, opDrop, op1)
+
+			err := verifyScript(nil, script, tx, 0)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("verifyScript returned %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMinimalPush(t *testing.T) {
+	data := make([]byte, opPushData1)
+
+	tests := []struct {
+		name   string
+		script []byte
+		want   bool
+	}{
+		{"OP_0", []byte{op0}, true},
+		{"OP_16", []byte{op16}, true},
+		{"direct push", pushAll([]byte{17}), true},
+		{"OP_PUSHDATA1", pushAll(data), true},
+		{"empty data of OP_PUSHDATA1", []byte{opPushData1, 0}, false},
+		{"small number as data", []byte{1, 16}, false},
+		{"short data of OP_PUSHDATA1", append([]byte{opPushData1, 1}, 17), false},
+		{"short data of OP_PUSHDATA2", append([]byte{opPushData2, opPushData1, 0}, data...), false},
+		{"not a push", []byte{opDup}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := parseScript(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ops[0].isMinimalPush(); got != tt.want {
+				t.Fatalf("isMinimalPush is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
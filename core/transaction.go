@@ -3,54 +3,127 @@ package core
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/btcsuite/btcutil/base58"
 	"log"
-	"math/big"
 )
 
+// Transaction moves value from outputs spent by Vin to new outputs.
+// LockTime is the first block height or, from LockTimeThreshold on, unix time
+// the transaction can be mined at. Zero means no lock
 type Transaction struct {
-	ID   []byte
-	Vin  []TXInput
-	Vout []TXOutput
-}
-
-type ScriptSig struct {
-	Signature []byte
-	PublicKey []byte
+	ID       []byte
+	Vin      []TXInput
+	Vout     []TXOutput
+	LockTime uint32
 }
 
+// TXInput spends an output. ScriptSig pushes the data ScriptPubKey of the output asks for,
+// e.g. a signature and a public key. Sequence is a relative lock on the spent output, see SequenceTimeFlag
 type TXInput struct {
 	Txid      []byte
 	TxoutIdx  int
-	ScriptSig *ScriptSig
+	ScriptSig []byte
+	Sequence  uint32
 }
 
+// TXOutput locks Value with ScriptPubKey, a script which the input spending it has to satisfy
 type TXOutput struct {
 	Value        int
 	ScriptPubKey []byte
 }
 
-// NewUTXOTransaction creates a new transaction
-func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *Transaction {
+var (
+	ErrInsufficientFunds = errors.New("not enough funds")
+	ErrInvalidAddress    = errors.New("invalid address")
+	ErrNotOwnOutput      = errors.New("input spends an output which is not locked to the signing key")
+)
+
+// TXOutputs keeps unspent outputs of a transaction by their index
+// with the height of the block which created them
+type TXOutputs struct {
+	Outputs  map[int]TXOutput
+	Coinbase bool
+	Height   int
+}
+
+// newTXOutputs makes an entry of the UTXO set for outputs of tx in the block at height.
+// Unspendable outputs are left out
+func newTXOutputs(tx *Transaction, height int) TXOutputs {
+	outs := TXOutputs{make(map[int]TXOutput), tx.IsCoinbase(), height}
+	for index, out := range tx.Vout {
+		if isUnspendable(out.ScriptPubKey) {
+			continue
+		}
+		outs.Outputs[index] = out
+	}
+
+	return outs
+}
+
+// IsMature tells whether the outputs can be spent by a block at height
+func (outs TXOutputs) IsMature(height, maturity int) bool {
+	return !outs.Coinbase || height-outs.Height >= maturity
+}
+
+// NewUTXOTransaction creates a new transaction paying amount from the wallet address from to address to.
+// Inputs exceed outputs by fee, which goes to the miner of the block.
+// The transaction can't be mined before lockTime, see Transaction
+func NewUTXOTransaction(from, to string, amount, fee int, lockTime uint32, UTXOSet *UTXOSet) (*Transaction, error) {
+	out, err := NewTXOutput(amount, to, UTXOSet.Blockchain.params)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWalletTransaction(from, []TXOutput{*out}, fee, lockTime, UTXOSet)
+}
+
+// NewUTXOTransactionWithFeeRate creates a new transaction paying feeRate coins for every byte of it,
+// which is the rate miners order the mempool by
+func NewUTXOTransactionWithFeeRate(from, to string, amount, feeRate int, lockTime uint32, UTXOSet *UTXOSet) (*Transaction, error) {
+	out, err := NewTXOutput(amount, to, UTXOSet.Blockchain.params)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWalletTransactionWithFeeRate(from, []TXOutput{*out}, feeRate, lockTime, UTXOSet)
+}
+
+// NewWalletTransaction creates a new transaction paying outputs with outputs found in the UTXO set
+// which are locked to the wallet address from. Inputs exceed outputs by fee and the change goes back to from
+func NewWalletTransaction(from string, outputs []TXOutput, fee int, lockTime uint32, UTXOSet *UTXOSet) (*Transaction, error) {
 	var inputs []TXInput
-	var outputs []TXOutput
 
-	wallets, err := NewWallets()
+	params := UTXOSet.Blockchain.params
+	wallets, err := NewWallets(UTXOSet.Blockchain.config)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
+	}
+	wallet, err := wallets.GetWallet(from)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := fee
+	for _, out := range outputs {
+		amount += out.Value
+	}
+	// Every transaction needs an input, even one which only carries data and pays no fee
+	needed := max(amount, 1)
+	script := payToPubKeyHashScript(HashPublicKey(wallet.PublicKey))
+	balance, validOutputs, err := UTXOSet.FindMyUTXOs(script, needed)
+	if err != nil {
+		return nil, err
 	}
-	wallet := wallets.GetWallet(from)
-	publicKeyHash := HashPublicKey(wallet.PublicKey)
-	balance, validOutputs := bc.FindUTXOs(publicKeyHash, amount)
 
-	if balance < amount {
-		log.Panic("ERROR: Not enough funds")
+	if balance < needed {
+		return nil, ErrInsufficientFunds
 	}
 
 	// Build a list of inputs
@@ -58,24 +131,49 @@ func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *Transactio
 		for _, out := range outs {
 			txID, err := hex.DecodeString(txid)
 			if err != nil {
-				log.Panic(err)
+				return nil, err
 			}
-			input := TXInput{txID, out, &ScriptSig{nil, wallet.PublicKey}}
+			input := TXInput{txID, out, nil, 0}
 			inputs = append(inputs, input)
 		}
 	}
 
 	// Build a list of outputs
-	outputs = append(outputs, *NewTXOutput(amount, to))
+	outputs = append([]TXOutput{}, outputs...)
 	if balance > amount {
-		outputs = append(outputs, *NewTXOutput(balance-amount, from))
+		change, err := NewTXOutput(balance-amount, from, params)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *change)
 	}
 
-	tx := Transaction{nil, inputs, outputs}
+	tx := Transaction{nil, inputs, outputs, lockTime}
+	err = UTXOSet.Blockchain.SignTransaction(&tx, wallet.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
 	tx.SetID()
-	bc.SignTransaction(&tx, wallet.PrivateKey)
 
-	return &tx
+	return &tx, nil
+}
+
+// NewWalletTransactionWithFeeRate is NewWalletTransaction paying feeRate coins for every byte of the transaction
+func NewWalletTransactionWithFeeRate(from string, outputs []TXOutput, feeRate int, lockTime uint32, UTXOSet *UTXOSet) (*Transaction, error) {
+	fee := 0
+	for {
+		tx, err := NewWalletTransaction(from, outputs, fee, lockTime, UTXOSet)
+		if err != nil {
+			return nil, err
+		}
+
+		// A higher fee may need more inputs, so the size is checked again
+		needed := feeRate * tx.Size()
+		if needed <= fee {
+			return tx, nil
+		}
+		fee = needed
+	}
 }
 
 // IsCoinbase checks whether the transaction is coinbase
@@ -85,160 +183,244 @@ func (tx Transaction) IsCoinbase() bool {
 
 // SetID sets ID of a transaction
 func (tx *Transaction) SetID() {
-	var encoded bytes.Buffer
-	var hash [32]byte
-
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	if err != nil {
-		log.Panic(err)
-	}
-	hash = sha256.Sum256(encoded.Bytes())
-
-	tx.ID = hash[:]
+	tx.ID = tx.Hash()
 }
 
-// Creates a abbreviated copy of Transaction to use in sign
-func (tx *Transaction) AbbreviatedCopy() Transaction {
-	var inputs []TXInput
-
-	// The public key stored in the input doesn't need to be signed.
+// Hash is the hash of inputs, outputs and the lock time of the transaction, which is its ID.
+// Fields are written in a fixed binary format, as gob output differs between nodes
+func (tx *Transaction) Hash() []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(tx.Vin)))
 	for _, vin := range tx.Vin {
-		inputs = append(inputs, TXInput{vin.Txid, vin.TxoutIdx, nil})
+		data = appendBytes(data, vin.Txid)
+		data = binary.LittleEndian.AppendUint32(data, uint32(vin.TxoutIdx))
+		data = appendBytes(data, vin.ScriptSig)
+		data = binary.LittleEndian.AppendUint32(data, vin.Sequence)
 	}
+	data = appendOutputs(data, tx.Vout)
+	data = binary.LittleEndian.AppendUint32(data, tx.LockTime)
 
-	abbreviatedTx := Transaction{tx.ID, inputs, tx.Vout}
-
-	return abbreviatedTx
+	hash := sha256.Sum256(data)
+	return hash[:]
 }
 
-// Signs each input of a Transaction
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
-	if tx.IsCoinbase() {
-		return
-	}
-
-	for _, vin := range tx.Vin {
-		if prevTXs[hex.EncodeToString(vin.Txid)].ID == nil {
-			log.Panic("Error with Previous transaction")
+// SigHash is the hash a signature of input inIdx commits to. It covers outpoints and sequences
+// of all inputs, all outputs, the lock time and subscript, the script of the output spent by the input.
+// Scripts of inputs are left out, as they hold the signatures.
+// Fields are written in a fixed binary format, so every node computes the same hash
+func (tx *Transaction) SigHash(inIdx int, subscript []byte) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(tx.Vin)))
+	for i, vin := range tx.Vin {
+		data = appendBytes(data, vin.Txid)
+		data = binary.LittleEndian.AppendUint32(data, uint32(vin.TxoutIdx))
+		if i == inIdx {
+			data = appendBytes(data, subscript)
+		} else {
+			data = appendBytes(data, nil)
 		}
+		data = binary.LittleEndian.AppendUint32(data, vin.Sequence)
 	}
 
-	abbreviatedTx := tx.AbbreviatedCopy()
+	data = appendOutputs(data, tx.Vout)
+	data = binary.LittleEndian.AppendUint32(data, tx.LockTime)
+	data = binary.LittleEndian.AppendUint32(data, uint32(inIdx))
 
-	for inId, vin := range abbreviatedTx.Vin {
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
 
-		abbreviatedTx.Vin[inId].ScriptSig = &ScriptSig{}
-		abbreviatedTx.Vin[inId].ScriptSig.PublicKey = prevTx.Vout[vin.TxoutIdx].ScriptPubKey
+// appendBytes appends the length of b and b
+func appendBytes(data, b []byte) []byte {
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(b)))
 
-		// Use ECDSA(not RSA)
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, abbreviatedTx.ID)
-		if err != nil {
-			log.Panic(err)
-		}
-		signature := append(r.Bytes(), s.Bytes()...)
+	return append(data, b...)
+}
 
-		tx.Vin[inId].ScriptSig.Signature = signature
-		abbreviatedTx.Vin[inId].ScriptSig.PublicKey = nil
+// appendOutputs appends the number of outputs and the value and script of each
+func appendOutputs(data []byte, vout []TXOutput) []byte {
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(vout)))
+	for _, out := range vout {
+		data = binary.LittleEndian.AppendUint64(data, uint64(out.Value))
+		data = appendBytes(data, out.ScriptPubKey)
 	}
+
+	return data
 }
 
-// Verifies signatures of Transaction inputs
-func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
+// Sign signs every input, which has to spend a pay to public key hash output of privKey.
+// The ID changes with the signatures, so it is set after signing
+func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) error {
 	if tx.IsCoinbase() {
-		return true
+		return nil
 	}
 
 	for _, vin := range tx.Vin {
-		if prevTXs[hex.EncodeToString(vin.Txid)].ID == nil {
-			log.Panic("Error with Previous transaction")
+		if !hasPrevOutput(prevTXs, vin) {
+			return ErrMissingInput
 		}
 	}
 
-	abbreviatedTx := tx.AbbreviatedCopy()
-	curve := elliptic.P256() // The same curve used to generate key pairs.
+	publicKey := encodePublicKey(&privKey.PublicKey)
+	publicKeyHash := HashPublicKey(publicKey)
 
-	for inId, vin := range tx.Vin {
+	for inIdx, vin := range tx.Vin {
 		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
+		prevOut := prevTx.Vout[vin.TxoutIdx]
+		if !prevOut.IsLockedWithKey(publicKeyHash) {
+			return ErrNotOwnOutput
+		}
 
-		abbreviatedTx.Vin[inId].ScriptSig = &ScriptSig{}
-		abbreviatedTx.Vin[inId].ScriptSig.PublicKey = prevTx.Vout[vin.TxoutIdx].ScriptPubKey
+		signature, err := signHash(&privKey, tx.SigHash(inIdx, prevOut.ScriptPubKey))
+		if err != nil {
+			return err
+		}
+		tx.Vin[inIdx].ScriptSig = pushData(pushData(nil, signature), publicKey)
+	}
 
-		sigLen := len(vin.ScriptSig.Signature)
-		keyLen := len(vin.ScriptSig.PublicKey)
+	return nil
+}
+
+// hasPrevOutput checks whether prevTXs contain the output spent by an input
+func hasPrevOutput(prevTXs map[string]Transaction, vin TXInput) bool {
+	prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
 
-		var r, s big.Int
-		var x, y big.Int
+	return prevTx.ID != nil && vin.TxoutIdx >= 0 && vin.TxoutIdx < len(prevTx.Vout)
+}
 
-		// Signature is a pair of numbers.
-		r.SetBytes(vin.ScriptSig.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.ScriptSig.Signature[(sigLen / 2):])
+// Verify runs the script of every input against the script of the output it spends
+func (tx *Transaction) Verify(prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
 
-		// PublicKey is a pair of coordinates.
-		x.SetBytes(vin.ScriptSig.PublicKey[:(keyLen / 2)])
-		y.SetBytes(vin.ScriptSig.PublicKey[(keyLen / 2):])
+	for inIdx, vin := range tx.Vin {
+		if !hasPrevOutput(prevTXs, vin) {
+			return ErrMissingInput
+		}
+		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
 
-		rawPublicKey := &ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-		if !ecdsa.Verify(rawPublicKey, abbreviatedTx.ID, &r, &s) {
-			return false
+		err := verifyScript(vin.ScriptSig, prevTx.Vout[vin.TxoutIdx].ScriptPubKey, tx, inIdx)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", inIdx, err)
 		}
-		abbreviatedTx.Vin[inId].ScriptSig.PublicKey = nil
 	}
-	return true
+
+	return nil
 }
 
-// Unlock Tx
+// Unlock checks whether the input is signed by the key whose hash is publicKeyHash,
+// which is the last data a pay to public key hash input pushes
 func (tI TXInput) Unlock(publicKeyHash []byte) bool {
-	lockingHash := HashPublicKey(tI.ScriptSig.PublicKey)
+	ops, err := parseScript(tI.ScriptSig)
+	if err != nil || len(ops) == 0 {
+		return false
+	}
 
-	return bytes.Equal(lockingHash, publicKeyHash)
+	return bytes.Equal(HashPublicKey(ops[len(ops)-1].data), publicKeyHash)
 }
 
-// Check key
+// IsLockedWithKey checks whether the output pays to the public key hash
 func (tO TXOutput) IsLockedWithKey(publicKeyHash []byte) bool {
-	return bytes.Equal(tO.ScriptPubKey, publicKeyHash)
+	lockingHash, ok := extractPubKeyHash(tO.ScriptPubKey)
+
+	return ok && bytes.Equal(lockingHash, publicKeyHash)
+}
+
+// Address returns the address the output is locked to on the network of params.
+// Outputs with other scripts than the standard ones have no address
+func (tO TXOutput) Address(params *ChainParams) string {
+	return params.ScriptAddress(tO.ScriptPubKey)
 }
 
-// Lock with publicKey
-func (tO *TXOutput) Lock(address string) {
-	publicKeyHash, _, err := base58.CheckDecode(address)
+// Lock locks the output with the script of address
+func (tO *TXOutput) Lock(address string, params *ChainParams) error {
+	script, err := params.AddressScript(address)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-	tO.ScriptPubKey = publicKeyHash
+	tO.ScriptPubKey = script
+
+	return nil
 }
 
 // NewTXOutput creates a new TXOutput
-func NewTXOutput(value int, address string) *TXOutput {
+func NewTXOutput(value int, address string, params *ChainParams) (*TXOutput, error) {
 	txo := &TXOutput{value, nil}
-	txo.Lock(address)
+	err := txo.Lock(address, params)
+	if err != nil {
+		return nil, err
+	}
 
-	return txo
+	return txo, nil
 }
 
-// NewCoinbaseTX creates a new coinbase transaction
-func NewCoinbaseTX(to, data string) *Transaction {
+// NewCoinbaseTX creates a new coinbase transaction paying value to address to.
+// A block may claim at most its subsidy and fees of its transactions
+func NewCoinbaseTX(to, data string, value int, params *ChainParams) (*Transaction, error) {
 	if data == "Mining reward" {
 		b := make([]byte, 10)
 		_, err := rand.Read(b)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
 
 		data = fmt.Sprintf("%x", b)
 	}
 
-	txin := TXInput{[]byte{}, -1, &ScriptSig{nil, []byte(data)}}
-	txout := *NewTXOutput(subsidy, to)
-	tx := Transaction{nil, []TXInput{txin}, []TXOutput{txout}}
+	txin := TXInput{[]byte{}, -1, pushData(nil, []byte(data)), 0}
+	txout, err := NewTXOutput(value, to, params)
+	if err != nil {
+		return nil, err
+	}
+	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}, 0}
 	tx.SetID()
 
-	return &tx
+	return &tx, nil
+}
+
+// MarshalJSON encodes a transaction with hex strings instead of base64 byte slices
+func (tx Transaction) MarshalJSON() ([]byte, error) {
+	vin := make([]map[string]any, 0, len(tx.Vin))
+	for _, in := range tx.Vin {
+		vin = append(vin, map[string]any{
+			"Txid":      hex.EncodeToString(in.Txid),
+			"TxoutIdx":  in.TxoutIdx,
+			"ScriptSig": hex.EncodeToString(in.ScriptSig),
+			"Sequence":  in.Sequence,
+		})
+	}
+
+	vout := make([]map[string]any, 0, len(tx.Vout))
+	for _, out := range tx.Vout {
+		vout = append(vout, map[string]any{
+			"Value":        out.Value,
+			"ScriptPubKey": hex.EncodeToString(out.ScriptPubKey),
+		})
+	}
+
+	mapStringAny := map[string]any{
+		"ID":       hex.EncodeToString(tx.ID),
+		"Vin":      vin,
+		"Vout":     vout,
+		"LockTime": tx.LockTime,
+	}
+	return json.Marshal(mapStringAny)
+}
+
+// DeserializeTransaction deserializes a transaction
+func DeserializeTransaction(data []byte) (Transaction, error) {
+	var transaction Transaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&transaction)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("decode transaction: %w", err)
+	}
+
+	return transaction, nil
 }
 
-// SerializeTxs serializes TXOutputs
-func SerializeTxs(outs []TXOutput) []byte {
+// Serialize serializes TXOutputs
+func (outs TXOutputs) Serialize() []byte {
 	var writer bytes.Buffer
 
 	enc := gob.NewEncoder(&writer)
@@ -250,15 +432,15 @@ func SerializeTxs(outs []TXOutput) []byte {
 	return writer.Bytes()
 }
 
-// DeserializeTxs deserializes TXOutputs
-func DeserializeTxs(data []byte) []TXOutput {
-	var writer []TXOutput
+// DeserializeOutputs deserializes TXOutputs
+func DeserializeOutputs(data []byte) (TXOutputs, error) {
+	var outputs TXOutputs
 
 	dec := gob.NewDecoder(bytes.NewReader(data))
-	err := dec.Decode(&writer)
+	err := dec.Decode(&outputs)
 	if err != nil {
-		log.Panic(err)
+		return TXOutputs{}, fmt.Errorf("decode outputs: %w", err)
 	}
 
-	return writer
+	return outputs, nil
 }
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/boltdb/bolt"
+)
+
+// txIndexBucket maps IDs of main chain transactions to the block containing them.
+// The index is optional, without the bucket transactions are found by scanning blocks
+const txIndexBucket = "txindex"
+
+var ErrTransactionNotFound = errors.New("transaction is not found")
+
+// txLocation is the value of a transaction index entry,
+// 4 bytes of position in the block followed by the block hash
+func txLocation(blockHash []byte, position int) []byte {
+	value := make([]byte, 4, 4+len(blockHash))
+	binary.BigEndian.PutUint32(value, uint32(position))
+
+	return append(value, blockHash...)
+}
+
+// indexTransactions adds transactions of a connected block to the index if it is enabled
+func indexTransactions(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for position, transaction := range block.Transactions {
+		err := b.Put(transaction.ID, txLocation(block.Hash, position))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexTransactions removes transactions of a disconnected block from the index if it is enabled
+func unindexTransactions(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for _, transaction := range block.Transactions {
+		err := b.Delete(transaction.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindTransaction returns a main chain transaction and the block containing it
+func (bc *Blockchain) FindTransaction(id []byte) (*Transaction, *Block, error) {
+	var location []byte
+	indexed := false
+
+	err := bc.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(txIndexBucket))
+		if b == nil {
+			return nil
+		}
+		indexed = true
+
+		if value := b.Get(id); value != nil {
+			location = append([]byte{}, value...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !indexed {
+		return bc.scanTransaction(id)
+	}
+	if len(location) < 4 {
+		return nil, nil, ErrTransactionNotFound
+	}
+
+	block, err := bc.GetBlock(location[4:])
+	if err != nil {
+		return nil, nil, err
+	}
+	position := int(binary.BigEndian.Uint32(location[:4]))
+	if position >= len(block.Transactions) {
+		return nil, nil, ErrTransactionNotFound
+	}
+
+	return block.Transactions[position], &block, nil
+}
+
+// scanTransaction looks for a transaction in every block of the main chain
+func (bc *Blockchain) scanTransaction(id []byte) (*Transaction, *Block, error) {
+	bcI := bc.Iterator()
+	for {
+		block, err := bcI.GetNextBlock()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, id) {
+				return tx, block, nil
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return nil, nil, ErrTransactionNotFound
+}
+
+// ReindexTransactions enables the transaction index and rebuilds it from the main chain.
+// It returns the number of indexed transactions
+func (bc *Blockchain) ReindexTransactions() (int, error) {
+	count := 0
+
+	err := bc.Db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(txIndexBucket))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		_, err = tx.CreateBucket([]byte(txIndexBucket))
+		if err != nil {
+			return err
+		}
+
+		blocks := tx.Bucket([]byte("blocks"))
+		for hash := bc.tip(); len(hash) > 0; {
+			block, err := DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return err
+			}
+			err = indexTransactions(tx, block)
+			if err != nil {
+				return err
+			}
+			count += len(block.Transactions)
+			hash = block.PrevHash
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
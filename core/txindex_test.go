@@ -0,0 +1,61 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"github.com/boltdb/bolt"
+	"testing"
+)
+
+// checkFindTransaction checks every transaction of blocks is found in its block
+func checkFindTransaction(t *testing.T, bc *Blockchain, blocks []*Block) {
+	t.Helper()
+
+	for _, block := range blocks {
+		for _, want := range block.Transactions {
+			tx, found, err := bc.FindTransaction(want.ID)
+			if err != nil {
+				t.Fatalf("FindTransaction of %x returned %v", want.ID, err)
+			}
+			if !bytes.Equal(tx.ID, want.ID) || !bytes.Equal(found.Hash, block.Hash) {
+				t.Fatalf("found transaction %x in block %x, want %x in %x", tx.ID, found.Hash, want.ID, block.Hash)
+			}
+		}
+	}
+}
+
+func TestTransactionIndex(t *testing.T) {
+	bc, address := newTestChain(t)
+	blocks := mineBlocks(t, bc, address, NewMempool(bc), 3)
+	checkFindTransaction(t, bc, blocks)
+
+	// Transactions of disconnected blocks are not in the main chain any more
+	if err := bc.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bc.FindTransaction(blocks[2].Transactions[0].ID); !errors.Is(err, ErrTransactionNotFound) {
+		t.Fatalf("FindTransaction of a disconnected transaction returned %v, want %v", err, ErrTransactionNotFound)
+	}
+	blocks = blocks[:2]
+
+	// Without the index blocks are scanned
+	err := bc.Db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(txIndexBucket))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindTransaction(t, bc, blocks)
+
+	count, err := bc.ReindexTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(blocks) + 1; count != want {
+		t.Fatalf("ReindexTransactions indexed %d transactions, want %d", count, want)
+	}
+	checkFindTransaction(t, bc, blocks)
+	if _, _, err := bc.FindTransaction(make([]byte, 32)); !errors.Is(err, ErrTransactionNotFound) {
+		t.Fatalf("FindTransaction of an unknown ID returned %v, want %v", err, ErrTransactionNotFound)
+	}
+}
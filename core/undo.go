@@ -0,0 +1,46 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"log"
+)
+
+const undoBucket = "undo"
+
+var ErrNoUndoData = errors.New("block has no undo data")
+
+// spentOutput is an output spent by a block.
+// It is kept to put the output back into the UTXO set when the block is disconnected
+type spentOutput struct {
+	Txid     []byte
+	Index    int
+	Output   TXOutput
+	Coinbase bool
+	Height   int
+}
+
+func serializeUndo(spent []spentOutput) []byte {
+	var value bytes.Buffer
+
+	encoder := gob.NewEncoder(&value)
+	err := encoder.Encode(spent)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return value.Bytes()
+}
+
+func deserializeUndo(d []byte) ([]spentOutput, error) {
+	var spent []spentOutput
+
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	err := decoder.Decode(&spent)
+	if err != nil {
+		return nil, err
+	}
+
+	return spent, nil
+}
@@ -1,16 +1,18 @@
 package core
 
 import (
+	"bytes"
 	"encoding/hex"
 	"github.com/boltdb/bolt"
-	"log"
 )
 
 const utxoBucket = "chainstate"
 
-// UTXOSet represents UTXO set
+// UTXOSet represents UTXO set.
+// If Mempool is set, coin selection skips outputs spent by its transactions
 type UTXOSet struct {
 	Blockchain *Blockchain
+	Mempool    *Mempool
 }
 
 func (u UTXOSet) init(db *bolt.DB, bucketName []byte) error {
@@ -35,18 +37,21 @@ func (u UTXOSet) init(db *bolt.DB, bucketName []byte) error {
 }
 
 // Builds the UTXO set
-func (u UTXOSet) Build() {
+func (u UTXOSet) Build() error {
 	db := u.Blockchain.Db
 
-	bucketName := []byte(utxoBucket)
-	err := u.init(db, bucketName)
+	UTXO, err := u.Blockchain.FindAllUTXOs()
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
-	UTXO := u.Blockchain.FindAllUTXOs()
+	bucketName := []byte(utxoBucket)
+	err = u.init(db, bucketName)
+	if err != nil {
+		return err
+	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketName)
 
 		for txID, outs := range UTXO {
@@ -54,7 +59,7 @@ func (u UTXOSet) Build() {
 			if err != nil {
 				return err
 			}
-			err = b.Put(key, SerializeTxs(outs))
+			err = b.Put(key, outs.Serialize())
 			if err != nil {
 				return err
 			}
@@ -62,119 +67,293 @@ func (u UTXOSet) Build() {
 
 		return nil
 	})
+}
+
+// spendHeight returns the height of the next block, which is the earliest block to spend outputs of the set
+func (u UTXOSet) spendHeight() (int, error) {
+	bestHeight, err := u.Blockchain.GetBestHeight()
 	if err != nil {
-		log.Panic(err)
+		return 0, err
 	}
+
+	return bestHeight + 1, nil
 }
 
-// Finds UTXO in chainstate
-func (u UTXOSet) FindUTXOs(pubKeyHash []byte) []TXOutput {
+// Finds UTXO locked with script in chainstate which can be spent in the next block
+func (u UTXOSet) FindUTXOs(script []byte) ([]TXOutput, error) {
+	return u.findUTXOs(script, true)
+}
+
+// FindImmatureUTXOs finds coinbase outputs locked with script in chainstate which can't be spent yet
+func (u UTXOSet) FindImmatureUTXOs(script []byte) ([]TXOutput, error) {
+	return u.findUTXOs(script, false)
+}
+
+func (u UTXOSet) findUTXOs(script []byte, mature bool) ([]TXOutput, error) {
 	var UTXOs []TXOutput
 	db := u.Blockchain.Db
+	maturity := u.Blockchain.params.CoinbaseMaturity
+	height, err := u.spendHeight()
+	if err != nil {
+		return nil, err
+	}
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 
-		b.ForEach(func(k, v []byte) error {
-			outs := DeserializeTxs(v)
+		return b.ForEach(func(k, v []byte) error {
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			if outs.IsMature(height, maturity) != mature {
+				return nil
+			}
 
-			for _, out := range outs {
-				if out.IsLockedWithKey(pubKeyHash) {
+			for _, out := range outs.Outputs {
+				if bytes.Equal(out.ScriptPubKey, script) {
 					UTXOs = append(UTXOs, out)
 				}
 			}
 			return nil
 		})
-
-		return nil
 	})
+
+	return UTXOs, err
+}
+
+// UnspentOutput is an unspent output with the outpoint it is found at
+type UnspentOutput struct {
+	Txid   []byte
+	Index  int
+	Output TXOutput
+}
+
+// FindUnspentOutputs finds spendable UTXO locked with script together with their outpoints
+func (u UTXOSet) FindUnspentOutputs(script []byte) ([]UnspentOutput, error) {
+	var unspent []UnspentOutput
+	db := u.Blockchain.Db
+	maturity := u.Blockchain.params.CoinbaseMaturity
+	height, err := u.spendHeight()
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	return UTXOs
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+
+		return b.ForEach(func(k, v []byte) error {
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			if !outs.IsMature(height, maturity) {
+				return nil
+			}
+
+			for index, out := range outs.Outputs {
+				if bytes.Equal(out.ScriptPubKey, script) {
+					unspent = append(unspent, UnspentOutput{append([]byte{}, k...), index, out})
+				}
+			}
+			return nil
+		})
+	})
+
+	return unspent, err
 }
 
 // Updates the UTXO set(Add new UTXO && Remove used UTXO)
-func (u UTXOSet) Update(block *Block) {
-	db := u.Blockchain.Db
+// and keeps the removed outputs as undo data of the block
+func (u UTXOSet) Update(block *Block) error {
+	return u.Blockchain.Db.Update(func(tx *bolt.Tx) error {
+		return connectOutputs(tx, block)
+	})
+}
 
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
+// Disconnect rolls the UTXO set back to the state before the block
+// using undo data of the block
+func (u UTXOSet) Disconnect(block *Block) error {
+	return u.Blockchain.Db.Update(func(tx *bolt.Tx) error {
+		return disconnectOutputs(tx, block)
+	})
+}
 
-		for _, tx := range block.Transactions {
-			if !tx.IsCoinbase() {
-				// Remove used UTXO
-				for _, vin := range tx.Vin {
-					var newOuts []TXOutput
-					data := b.Get(vin.Txid)
-					outs := DeserializeTxs(data)
-
-					for outIdx, out := range outs {
-						if outIdx != vin.TxoutIdx {
-							newOuts = append(newOuts, out)
-						}
-					}
+// connectOutputs removes outputs spent by the block, adds outputs it creates
+// and stores the removed outputs in undo bucket
+func connectOutputs(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(utxoBucket))
+	var undo []spentOutput
+
+	for _, transaction := range block.Transactions {
+		if !transaction.IsCoinbase() {
+			// Remove used UTXO
+			for _, vin := range transaction.Vin {
+				data := b.Get(vin.Txid)
+				if data == nil {
+					return ErrMissingInput
+				}
+				outs, err := DeserializeOutputs(data)
+				if err != nil {
+					return err
+				}
+				out, ok := outs.Outputs[vin.TxoutIdx]
+				if !ok {
+					return ErrMissingInput
+				}
+				undo = append(undo, spentOutput{vin.Txid, vin.TxoutIdx, out, outs.Coinbase, outs.Height})
+				delete(outs.Outputs, vin.TxoutIdx)
 
-					if len(newOuts) == 0 {
-						err := b.Delete(vin.Txid)
-						if err != nil {
-							log.Panic(err)
-						}
-					} else {
-						// Save other UTXOs that still available
-						err := b.Put(vin.Txid, SerializeTxs(newOuts))
-						if err != nil {
-							log.Panic(err)
-						}
+				if len(outs.Outputs) == 0 {
+					err := b.Delete(vin.Txid)
+					if err != nil {
+						return err
+					}
+				} else {
+					// Save other UTXOs that still available
+					err := b.Put(vin.Txid, outs.Serialize())
+					if err != nil {
+						return err
 					}
 				}
 			}
+		}
+
+		// Add new UTXO
+		newOuts := newTXOutputs(transaction, block.Height)
+		if len(newOuts.Outputs) == 0 {
+			continue
+		}
+		err := b.Put(transaction.ID, newOuts.Serialize())
+		if err != nil {
+			return err
+		}
+	}
 
-			// Add new UTXO
-			var newOuts []TXOutput
-			newOuts = append(newOuts, tx.Vout...)
+	return tx.Bucket([]byte(undoBucket)).Put(block.Hash, serializeUndo(undo))
+}
 
-			err := b.Put(tx.ID, SerializeTxs(newOuts))
+// disconnectOutputs removes outputs created by the block and restores outputs it spent
+// from undo data of the block
+func disconnectOutputs(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(utxoBucket))
+	undoData := tx.Bucket([]byte(undoBucket)).Get(block.Hash)
+	if undoData == nil {
+		return ErrNoUndoData
+	}
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		err := b.Delete(block.Transactions[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	undo, err := deserializeUndo(undoData)
+	if err != nil {
+		return err
+	}
+
+	for _, spent := range undo {
+		outs := TXOutputs{make(map[int]TXOutput), spent.Coinbase, spent.Height}
+		if data := b.Get(spent.Txid); data != nil {
+			outs, err = DeserializeOutputs(data)
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
 		}
+		outs.Outputs[spent.Index] = spent.Output
 
-		return nil
-	})
+		err := b.Put(spent.Txid, outs.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket([]byte(undoBucket)).Delete(block.Hash)
 }
 
-// Finds unspend transaction outputs for the address
-func (u UTXOSet) FindMyUTXOs(publicKeyHash []byte, amount int) (int, map[string][]int) {
+// Finds unspend transaction outputs locked with script which can be spent in the next block
+func (u UTXOSet) FindMyUTXOs(script []byte, amount int) (int, map[string][]int, error) {
 	unspentOutputs := make(map[string][]int)
 	db := u.Blockchain.Db
 	accumulated := 0
+	maturity := u.Blockchain.params.CoinbaseMaturity
+	height, err := u.spendHeight()
+	if err != nil {
+		return 0, nil, err
+	}
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 
-		b.ForEach(func(k, v []byte) error {
+		return b.ForEach(func(k, v []byte) error {
 			txID := hex.EncodeToString(k)
-			outs := DeserializeTxs(v)
-		Work:
-			for index, txout := range outs {
-				if txout.IsLockedWithKey(publicKeyHash) && accumulated < amount {
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			if !outs.IsMature(height, maturity) {
+				return nil
+			}
+
+			for index, txout := range outs.Outputs {
+				if accumulated >= amount {
+					break
+				}
+				if u.Mempool != nil && u.Mempool.IsSpent(k, index) {
+					continue
+				}
+				if bytes.Equal(txout.ScriptPubKey, script) {
 					accumulated += txout.Value
 					unspentOutputs[txID] = append(unspentOutputs[txID], index)
 				}
-				if accumulated >= amount {
-					break Work
-				}
 			}
 			return nil
 		})
-
-		return nil
 	})
 	if err != nil {
-		log.Panic(err)
+		return 0, nil, err
 	}
 
-	return accumulated, unspentOutputs
+	return accumulated, unspentOutputs, nil
+}
+
+// CountTransactions returns the number of transactions in the UTXO set
+func (u UTXOSet) CountTransactions() (int, error) {
+	db := u.Blockchain.Db
+	counter := 0
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		counter = b.Stats().KeyN
+
+		return nil
+	})
+
+	return counter, err
+}
+
+// TotalValue returns the sum of all unspent outputs, which is the number of coins in circulation
+func (u UTXOSet) TotalValue() (int, error) {
+	db := u.Blockchain.Db
+	total := 0
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+
+		return b.ForEach(func(k, v []byte) error {
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			for _, out := range outs.Outputs {
+				total += out.Value
+			}
+
+			return nil
+		})
+	})
+
+	return total, err
 }
@@ -0,0 +1,357 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	ErrInvalidProofOfWork = errors.New("block hash does not meet the target")
+	ErrCoinbasePosition   = errors.New("first transaction of a block is not coinbase")
+	ErrMultipleCoinbase   = errors.New("block has more than one coinbase")
+	ErrCoinbaseValue      = errors.New("coinbase pays more than subsidy and fees")
+	ErrBadSignature       = errors.New("transaction has an invalid signature")
+	ErrMissingInput       = errors.New("input references an unknown or spent output")
+	ErrDoubleSpend        = errors.New("output is spent twice in the block")
+	ErrValueInflation     = errors.New("transaction outputs exceed its inputs")
+	ErrImmatureCoinbase   = errors.New("input spends a coinbase output which is not mature yet")
+	ErrBadMerkleRoot      = errors.New("merkle root does not match transactions of the block")
+	ErrNoInputs           = errors.New("transaction has no inputs")
+	ErrBadTxID            = errors.New("transaction ID does not match its contents")
+	ErrValueOutOfRange    = errors.New("value is negative or exceeds the coin supply")
+	ErrTxIDInUse          = errors.New("transaction ID has unspent outputs already")
+	ErrDuplicateTx        = errors.New("block contains a transaction twice")
+)
+
+// ValidationError tells which transaction of a block broke a consensus rule
+type ValidationError struct {
+	TxID []byte
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("transaction %x: %v", e.TxID, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// utxoView holds unspent outputs referenced by inputs of a block at height,
+// read from the UTXO set and updated as transactions of the block are connected.
+// No value or sum of values may exceed maxMoney, so sums can't overflow
+type utxoView struct {
+	bc       *Blockchain
+	outputs  map[string]TXOutputs
+	height   int
+	maturity int
+	maxMoney int
+}
+
+// newUTXOView reads outputs of txs of a block at height and outputs referenced by their inputs from the UTXO set
+func (bc *Blockchain) newUTXOView(txs []*Transaction, height int) (*utxoView, error) {
+	view := &utxoView{bc, make(map[string]TXOutputs), height, bc.params.CoinbaseMaturity, bc.params.MaxSupply()}
+
+	err := bc.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+
+		for _, transaction := range txs {
+			if data := b.Get(transaction.ID); data != nil {
+				outs, err := DeserializeOutputs(data)
+				if err != nil {
+					return err
+				}
+				view.outputs[hex.EncodeToString(transaction.ID)] = outs
+			}
+			if transaction.IsCoinbase() {
+				continue
+			}
+			for _, vin := range transaction.Vin {
+				if data := b.Get(vin.Txid); data != nil {
+					outs, err := DeserializeOutputs(data)
+					if err != nil {
+						return err
+					}
+					view.outputs[hex.EncodeToString(vin.Txid)] = outs
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return view, err
+}
+
+// moneyRange tells whether value is an amount of coins which can exist
+func (v *utxoView) moneyRange(value int) bool {
+	return value >= 0 && value <= v.maxMoney
+}
+
+// hasUnspent tells whether a transaction with txID has unspent outputs
+func (v *utxoView) hasUnspent(txID []byte) bool {
+	return len(v.outputs[hex.EncodeToString(txID)].Outputs) > 0
+}
+
+// output returns an unspent output
+func (v *utxoView) output(txID string, index int) (TXOutput, bool) {
+	out, ok := v.outputs[txID].Outputs[index]
+
+	return out, ok
+}
+
+// prevTransaction rebuilds the part of a previous transaction
+// Transaction.Verify reads, which is the outputs referenced by inputs
+func (v *utxoView) prevTransaction(txID string) Transaction {
+	id, _ := hex.DecodeString(txID)
+	outs := v.outputs[txID].Outputs
+
+	maxIndex := -1
+	for index := range outs {
+		if index > maxIndex {
+			maxIndex = index
+		}
+	}
+	vout := make([]TXOutput, maxIndex+1)
+	for index, out := range outs {
+		vout[index] = out
+	}
+
+	return Transaction{id, nil, vout, 0}
+}
+
+// connect spends inputs of tx and makes its outputs available to later transactions
+func (v *utxoView) connect(tx *Transaction) {
+	if !tx.IsCoinbase() {
+		for _, vin := range tx.Vin {
+			delete(v.outputs[hex.EncodeToString(vin.Txid)].Outputs, vin.TxoutIdx)
+		}
+	}
+
+	v.outputs[hex.EncodeToString(tx.ID)] = newTXOutputs(tx, v.height)
+}
+
+// outpointKey identifies an output spent by a transaction input
+func outpointKey(vin TXInput) string {
+	return fmt.Sprintf("%x:%d", vin.Txid, vin.TxoutIdx)
+}
+
+// ValidateBlock checks height, timestamp, difficulty, seal and transactions of a block
+// which is going to extend the last block
+func (bc *Blockchain) ValidateBlock(block *Block) error {
+	parent, err := bc.GetBlock(block.PrevHash)
+	if err != nil {
+		return err
+	}
+	if block.Height != parent.Height+1 {
+		return ErrBadHeight
+	}
+	err = bc.checkTimestamp(&block.BlockHeader, &parent.BlockHeader)
+	if err != nil {
+		return err
+	}
+
+	bits, err := bc.engine.NextDifficulty(&parent.BlockHeader)
+	if err != nil {
+		return err
+	}
+	if block.Bits != bits {
+		return ErrBadDifficulty
+	}
+
+	err = bc.engine.VerifySeal(block)
+	if err != nil {
+		return err
+	}
+	err = block.checkMerkleRoot()
+	if err != nil {
+		return err
+	}
+
+	return bc.validateTransactions(block.Transactions, block.Height)
+}
+
+// checkMerkleRoot checks the header commits to the transactions of the block.
+// Leaves are transaction IDs, so every ID is computed again from its transaction.
+// The tree pairs the last node of an odd level with itself, so repeating the last
+// transactions gives the same root. Blocks with a transaction twice are rejected for that
+func (b *Block) checkMerkleRoot() error {
+	if len(b.Transactions) == 0 {
+		return ErrBadMerkleRoot
+	}
+	seen := make(map[string]bool)
+	for _, tx := range b.Transactions {
+		if !bytes.Equal(tx.ID, tx.Hash()) {
+			return &ValidationError{tx.ID, ErrBadTxID}
+		}
+		txID := hex.EncodeToString(tx.ID)
+		if seen[txID] {
+			return &ValidationError{tx.ID, ErrDuplicateTx}
+		}
+		seen[txID] = true
+	}
+	if !bytes.Equal(b.MerkleRoot, b.HashTransactions()) {
+		return ErrBadMerkleRoot
+	}
+
+	return nil
+}
+
+// validateTransactions checks transactions of a block at height against unspent outputs of the chain
+func (bc *Blockchain) validateTransactions(txs []*Transaction, height int) error {
+	if len(txs) == 0 || !txs[0].IsCoinbase() {
+		return ErrCoinbasePosition
+	}
+
+	view, err := bc.newUTXOView(txs, height)
+	if err != nil {
+		return err
+	}
+	// Outputs are stored by transaction ID, so a transaction with the ID of unspent outputs,
+	// e.g. a copied coinbase, would overwrite them and disconnecting it would delete them (BIP30)
+	for _, tx := range txs {
+		if view.hasUnspent(tx.ID) {
+			return &ValidationError{tx.ID, ErrTxIDInUse}
+		}
+	}
+
+	blockSpent := make(map[string]bool)
+	fees := 0
+
+	for _, tx := range txs[1:] {
+		if tx.IsCoinbase() {
+			return &ValidationError{tx.ID, ErrMultipleCoinbase}
+		}
+
+		fee, err := view.checkTransaction(tx, blockSpent)
+		if err != nil {
+			return &ValidationError{tx.ID, err}
+		}
+		fees += fee
+		if !view.moneyRange(fees) {
+			return &ValidationError{tx.ID, ErrValueOutOfRange}
+		}
+
+		view.connect(tx)
+	}
+
+	coinbaseValue := 0
+	for _, out := range txs[0].Vout {
+		coinbaseValue += out.Value
+		if !view.moneyRange(out.Value) || !view.moneyRange(coinbaseValue) {
+			return &ValidationError{txs[0].ID, ErrValueOutOfRange}
+		}
+	}
+	if coinbaseValue > bc.params.BlockSubsidy(height)+fees {
+		return &ValidationError{txs[0].ID, ErrCoinbaseValue}
+	}
+
+	return nil
+}
+
+// Fees returns the total fee paid by txs of the next block, which spend outputs of the UTXO set.
+// Coinbase transactions are skipped
+func (bc *Blockchain) Fees(txs []*Transaction) (int, error) {
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return 0, err
+	}
+	view, err := bc.newUTXOView(txs, bestHeight+1)
+	if err != nil {
+		return 0, err
+	}
+
+	fees := 0
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		fee, err := view.transactionFee(tx)
+		if err != nil {
+			return 0, &ValidationError{tx.ID, err}
+		}
+		fees += fee
+		if !view.moneyRange(fees) {
+			return 0, &ValidationError{tx.ID, ErrValueOutOfRange}
+		}
+
+		view.connect(tx)
+	}
+
+	return fees, nil
+}
+
+// transactionFee returns inputs minus outputs of a non-coinbase transaction
+func (v *utxoView) transactionFee(tx *Transaction) (int, error) {
+	inputValue := 0
+	for _, vin := range tx.Vin {
+		out, ok := v.output(hex.EncodeToString(vin.Txid), vin.TxoutIdx)
+		if !ok {
+			return 0, ErrMissingInput
+		}
+		inputValue += out.Value
+		if !v.moneyRange(out.Value) || !v.moneyRange(inputValue) {
+			return 0, ErrValueOutOfRange
+		}
+	}
+
+	outputValue := 0
+	for _, out := range tx.Vout {
+		outputValue += out.Value
+		if !v.moneyRange(out.Value) || !v.moneyRange(outputValue) {
+			return 0, ErrValueOutOfRange
+		}
+	}
+	if outputValue > inputValue {
+		return 0, ErrValueInflation
+	}
+
+	return inputValue - outputValue, nil
+}
+
+// checkTransaction validates inputs, time locks, values and signatures of a non-coinbase transaction
+// and returns its fee
+func (v *utxoView) checkTransaction(tx *Transaction, blockSpent map[string]bool) (int, error) {
+	prevTXs := make(map[string]Transaction)
+
+	if len(tx.Vin) == 0 {
+		return 0, ErrNoInputs
+	}
+	for _, vin := range tx.Vin {
+		txID := hex.EncodeToString(vin.Txid)
+		key := outpointKey(vin)
+		if blockSpent[key] {
+			return 0, ErrDoubleSpend
+		}
+
+		if _, ok := v.output(txID, vin.TxoutIdx); !ok {
+			return 0, ErrMissingInput
+		}
+		if !v.outputs[txID].IsMature(v.height, v.maturity) {
+			return 0, ErrImmatureCoinbase
+		}
+
+		blockSpent[key] = true
+		prevTXs[txID] = v.prevTransaction(txID)
+	}
+
+	if err := v.checkLocks(tx); err != nil {
+		return 0, err
+	}
+
+	fee, err := v.transactionFee(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Verify(prevTXs)
+	if err != nil {
+		return 0, err
+	}
+
+	return fee, nil
+}
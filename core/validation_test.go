@@ -0,0 +1,194 @@
+package core
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// resignTransaction signs tx again with the wallet of address after its outputs changed
+func resignTransaction(t *testing.T, bc *Blockchain, tx *Transaction, address string) {
+	t.Helper()
+
+	wallets, err := NewWallets(bc.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, err := wallets.GetWallet(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bc.SignTransaction(tx, wallet.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.SetID()
+}
+
+func TestValidateBlockRecomputesTransactionIDs(t *testing.T) {
+	bc, address := newTestChain(t)
+
+	block := newTestBlock(t, bc, []*Transaction{newTestCoinbase(t, bc, address)})
+	if err := bc.ValidateBlock(block); err != nil {
+		t.Fatalf("valid block: %v", err)
+	}
+
+	// The block hash commits to the unchanged ID
+	block.Transactions[0].Vout[0].Value++
+
+	if err := bc.ValidateBlock(block); !errors.Is(err, ErrBadTxID) {
+		t.Fatalf("ValidateBlock returned %v, want %v", err, ErrBadTxID)
+	}
+	if _, err := bc.ImportBlock(block); !errors.Is(err, ErrBadTxID) {
+		t.Fatalf("ImportBlock returned %v, want %v", err, ErrBadTxID)
+	}
+}
+
+func TestValueOverflowIsRejected(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+	mineBlocks(t, bc, address, mp, bc.params.CoinbaseMaturity)
+
+	tx, err := NewUTXOTransaction(address, address, bc.params.BlockSubsidy(0), 0, 0, &UTXOSet{bc, mp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := tx.Vout[0].ScriptPubKey
+
+	tests := []struct {
+		name   string
+		values []int
+		want   error
+	}{
+		{"sum wraps to zero", []int{math.MaxInt, math.MaxInt, 2}, ErrValueOutOfRange},
+		{"output above supply", []int{bc.params.MaxSupply() + 1}, ErrValueOutOfRange},
+		{"negative output", []int{-1, 2}, ErrValueOutOfRange},
+		{"outputs above inputs", []int{bc.params.BlockSubsidy(0) + 1}, ErrValueInflation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx.Vout = nil
+			for _, value := range tt.values {
+				tx.Vout = append(tx.Vout, TXOutput{value, script})
+			}
+			resignTransaction(t, bc, tx, address)
+
+			if err := mp.Add(tx); !errors.Is(err, tt.want) {
+				t.Fatalf("Add returned %v, want %v", err, tt.want)
+			}
+			block := newTestBlock(t, bc, []*Transaction{newTestCoinbase(t, bc, address), tx})
+			if err := bc.ValidateBlock(block); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateBlock returned %v, want %v", err, tt.want)
+			}
+			if _, err := bc.Fees([]*Transaction{tx}); !errors.Is(err, tt.want) {
+				t.Fatalf("Fees returned %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoinbaseValue(t *testing.T) {
+	bc, address := newTestChain(t)
+
+	tests := []struct {
+		name   string
+		values []int
+		want   error
+	}{
+		{"subsidy", []int{bc.params.BlockSubsidy(1)}, nil},
+		{"above subsidy", []int{bc.params.BlockSubsidy(1) + 1}, ErrCoinbaseValue},
+		{"sum wraps", []int{math.MaxInt, 2}, ErrValueOutOfRange},
+		{"negative output", []int{-1}, ErrValueOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := newTestCoinbase(t, bc, address)
+			script := cb.Vout[0].ScriptPubKey
+			cb.Vout = nil
+			for _, value := range tt.values {
+				cb.Vout = append(cb.Vout, TXOutput{value, script})
+			}
+			cb.SetID()
+
+			block := newTestBlock(t, bc, []*Transaction{cb})
+			if err := bc.ValidateBlock(block); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateBlock returned %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopiedCoinbaseIsRejected(t *testing.T) {
+	bc, address := newTestChain(t)
+	victim, err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied := *victim.Transactions[0]
+	block := newTestBlock(t, bc, []*Transaction{&copied})
+	if err := bc.ValidateBlock(block); !errors.Is(err, ErrTxIDInUse) {
+		t.Fatalf("ValidateBlock returned %v, want %v", err, ErrTxIDInUse)
+	}
+}
+
+func TestMempoolRejectsForgedTransactionID(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+	mineBlocks(t, bc, address, mp, bc.params.CoinbaseMaturity)
+
+	tx, err := NewUTXOTransaction(address, address, 1, 0, 0, &UTXOSet{bc, mp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Vout[0].Value++
+
+	if err := mp.Add(tx); !errors.Is(err, ErrBadTxID) {
+		t.Fatalf("Add returned %v, want %v", err, ErrBadTxID)
+	}
+}
+
+func TestMempoolRejectsMalleatedScriptSig(t *testing.T) {
+	bc, address := newTestChain(t)
+	mp := NewMempool(bc)
+	mineBlocks(t, bc, address, mp, bc.params.CoinbaseMaturity)
+
+	tx, err := NewUTXOTransaction(address, address, 1, 0, 0, &UTXOSet{bc, mp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := parseScript(tx.Vin[0].ScriptSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, pubKey := ops[0].data, ops[1].data
+
+	// Signatures don't cover scriptSig, so these spend the same output with other transaction IDs
+	tests := []struct {
+		name      string
+		scriptSig []byte
+	}{
+		{"push of a longer encoding", append(append([]byte{opPushData1, byte(len(signature))}, signature...), pushAll(pubKey)...)},
+		{"extra push", pushAll([]byte("extra"), signature, pubKey)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			malleated := *tx
+			malleated.Vin = []TXInput{tx.Vin[0]}
+			malleated.Vin[0].ScriptSig = tt.scriptSig
+			malleated.SetID()
+
+			if err := bc.ValidateBlock(newTestBlock(t, bc, []*Transaction{newTestCoinbase(t, bc, address), &malleated})); err != nil {
+				t.Fatalf("block with the transaction is invalid: %v", err)
+			}
+			if err := mp.Add(&malleated); !errors.Is(err, ErrNonStandard) {
+				t.Fatalf("Add returned %v, want %v", err, ErrNonStandard)
+			}
+		})
+	}
+
+	if err := mp.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,14 +6,21 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
-	"github.com/btcsuite/btcutil/base58"
+	"errors"
+	"fmt"
 	"golang.org/x/crypto/ripemd160"
-	"log"
+	"math/big"
 	"os"
 )
 
-const version = byte(0x00)
-const walletFile = "gowallet.dat"
+var (
+	ErrUnknownAddress   = errors.New("address is not in the wallet file")
+	ErrInvalidPublicKey = errors.New("public key is not a point of the curve")
+	ErrLegacyPublicKey  = errors.New("wallet of an older version has an unpadded public key, remove it from the wallet file")
+)
+
+// coordinateSize is the number of bytes of a P-256 coordinate or signature number
+const coordinateSize = 32
 
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey
@@ -22,18 +29,18 @@ type Wallet struct {
 
 type Wallets struct {
 	Wallets map[string]*Wallet
+	file    string
+	params  *ChainParams
 }
 
 // NewWallet generate New Wallet
-func NewWallet() *Wallet {
+func NewWallet() (*Wallet, error) {
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	publicKey := append(privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes()...)
-
-	return &Wallet{*privateKey, publicKey}
+	return &Wallet{*privateKey, encodePublicKey(&privateKey.PublicKey)}, nil
 }
 
 // HashPublicKey hashes public key
@@ -41,66 +48,154 @@ func HashPublicKey(pubKey []byte) []byte {
 	publicSHA256 := sha256.Sum256(pubKey) // Public key를 SHA-256으로 해싱
 
 	// RIPEMD-160으로 다시 해싱
+	// Write of a hash never returns an error
 	RIPEMD160Hasher := ripemd160.New()
-	_, err := RIPEMD160Hasher.Write(publicSHA256[:])
-	if err != nil {
-		log.Panic(err)
-	}
+	RIPEMD160Hasher.Write(publicSHA256[:])
 
 	publicRIPEMD160 := RIPEMD160Hasher.Sum(nil)
 	return publicRIPEMD160
 }
 
-// GetAddress gets wallet address
-func (w Wallet) GetAddress() string {
+// encodePublicKey joins X and Y coordinates of a public key, each padded to coordinateSize bytes
+func encodePublicKey(pubKey *ecdsa.PublicKey) []byte {
+	data := make([]byte, 2*coordinateSize)
+	pubKey.X.FillBytes(data[:coordinateSize])
+	pubKey.Y.FillBytes(data[coordinateSize:])
+
+	return data
+}
+
+// parsePublicKey makes a P-256 public key of X and Y coordinates joined by encodePublicKey
+func parsePublicKey(pubKey []byte) (*ecdsa.PublicKey, error) {
+	if len(pubKey) != 2*coordinateSize {
+		return nil, ErrInvalidPublicKey
+	}
+
+	var x, y big.Int
+	x.SetBytes(pubKey[:coordinateSize])
+	y.SetBytes(pubKey[coordinateSize:])
+
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(&x, &y) {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}, nil
+}
+
+// signHash signs hash with privKey. The signature is r and s, each padded to coordinateSize bytes.
+// Both s and N-s are valid, so only the lower one is used and others can't change the signature and the transaction ID
+func signHash(privKey *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, privKey, hash)
+	if err != nil {
+		return nil, err
+	}
+	if isHighS(privKey.Curve, s) {
+		s.Sub(privKey.Curve.Params().N, s)
+	}
+
+	signature := make([]byte, 2*coordinateSize)
+	r.FillBytes(signature[:coordinateSize])
+	s.FillBytes(signature[coordinateSize:])
+
+	return signature, nil
+}
+
+// verifySignature checks a signature made by signHash. Signatures with a high s are rejected
+func verifySignature(pubKey *ecdsa.PublicKey, hash, signature []byte) bool {
+	if len(signature) != 2*coordinateSize {
+		return false
+	}
+
+	var r, s big.Int
+	r.SetBytes(signature[:coordinateSize])
+	s.SetBytes(signature[coordinateSize:])
+	if isHighS(pubKey.Curve, &s) {
+		return false
+	}
+
+	return ecdsa.Verify(pubKey, hash, &r, &s)
+}
+
+// isHighS checks s is above half of the curve order
+func isHighS(curve elliptic.Curve, s *big.Int) bool {
+	halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+
+	return s.Cmp(halfOrder) > 0
+}
+
+// GetAddress gets wallet address on the network of params
+func (w Wallet) GetAddress(params *ChainParams) string {
 	publicKeyHash := HashPublicKey(w.PublicKey)
 
-	return base58.CheckEncode(publicKeyHash, version)
+	return params.EncodeAddress(publicKeyHash)
 }
 
 // CreateWallet adds a Wallet into Wallets
-func (ws *Wallets) CreateWallet() string {
-	wallet := NewWallet()
-	address := wallet.GetAddress()
+func (ws *Wallets) CreateWallet() (string, error) {
+	wallet, err := NewWallet()
+	if err != nil {
+		return "", err
+	}
+	address := wallet.GetAddress(ws.params)
 
 	ws.Wallets[address] = wallet
 
-	return address
+	return address, nil
 }
 
-// NewWallets creates wallets and files it from a file iff it exists
-func NewWallets() (*Wallets, error) {
+// NewWallets creates wallets and files it from the wallet file of config iff it exists
+func NewWallets(config *Config) (*Wallets, error) {
+	params, err := config.Params()
+	if err != nil {
+		return nil, err
+	}
+	walletFile, err := config.walletPath()
+	if err != nil {
+		return nil, err
+	}
+
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.file = walletFile
+	wallets.params = params
 
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
-		return &wallets, err
+	if !fileExists(walletFile) {
+		return &wallets, nil
 	}
 
 	fileContent, err := os.ReadFile(walletFile)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
 	err = json.Unmarshal(fileContent, &wallets)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	return &wallets, err
+	for address, wallet := range wallets.Wallets {
+		// Curve is not stored in the file
+		wallet.PrivateKey.Curve = elliptic.P256()
+
+		// Older wallets didn't pad coordinates, so some public keys are shorter.
+		// Padding them would change the address silently, and scripts don't accept them as they are
+		if len(wallet.PublicKey) != 2*coordinateSize {
+			return nil, fmt.Errorf("%s: %w", address, ErrLegacyPublicKey)
+		}
+	}
+
+	return &wallets, nil
 }
 
 // SaveToFile saves Wallets into a file
-func (ws Wallets) SaveToFile() {
+func (ws Wallets) SaveToFile() error {
 	jsonData, err := json.Marshal(ws)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
-	err = os.WriteFile(walletFile, jsonData, 0666)
-	if err != nil {
-		log.Panic(err)
-	}
+	return os.WriteFile(ws.file, jsonData, 0600)
 }
 
 // GetAddresses returns addresses stored at wallet file
@@ -115,8 +210,13 @@ func (ws *Wallets) GetAddresses() []string {
 }
 
 // GetWallet returns a Wallet by address
-func (ws Wallets) GetWallet(address string) Wallet {
-	return *ws.Wallets[address]
+func (ws Wallets) GetWallet(address string) (Wallet, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return Wallet{}, ErrUnknownAddress
+	}
+
+	return *wallet, nil
 }
 
 func (w Wallet) MarshalJSON() ([]byte, error) {
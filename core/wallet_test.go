@@ -0,0 +1,73 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSignaturesHaveLowS(t *testing.T) {
+	w := newTestWallets(t, 1)[0]
+	hash := make([]byte, 32)
+
+	for i := 0; i < 64; i++ {
+		hash[0] = byte(i)
+		signature, err := signHash(&w.PrivateKey, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verifySignature(&w.PrivateKey.PublicKey, hash, signature) {
+			t.Fatalf("signature %x is rejected", signature)
+		}
+	}
+}
+
+func TestLegacyPublicKeyIsRejected(t *testing.T) {
+	config := &Config{DataDir: t.TempDir(), Network: RegTest}
+	params, err := config.Params()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Older wallets joined coordinates without padding, so a key with a short coordinate was shorter
+	var w *Wallet
+	var legacyKey []byte
+	for legacyKey == nil || len(legacyKey) == 2*coordinateSize {
+		w = newTestWallets(t, 1)[0]
+		legacyKey = append(w.PrivateKey.X.Bytes(), w.PrivateKey.Y.Bytes()...)
+	}
+	w.PublicKey = legacyKey
+	address := w.GetAddress(params)
+
+	wallets, err := NewWallets(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallets.Wallets[address] = w
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	walletFile, err := config.walletPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(walletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewWallets(config)
+	if !errors.Is(err, ErrLegacyPublicKey) || !strings.Contains(err.Error(), address) {
+		t.Fatalf("NewWallets returned %v, want %v for %s", err, ErrLegacyPublicKey, address)
+	}
+	data, err := os.ReadFile(walletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, saved) {
+		t.Fatal("wallet file is changed")
+	}
+}
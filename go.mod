@@ -4,15 +4,15 @@ go 1.22
 
 require (
 	github.com/boltdb/bolt v1.3.1
+	github.com/btcsuite/btcutil v1.0.2
 	github.com/go-playground/validator v9.31.0+incompatible
+	golang.org/x/crypto v0.26.0
 )
 
 require (
-	github.com/btcsuite/btcutil v1.0.2 // indirect
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/leodido/go-urn v1.4.0 // indirect
-	golang.org/x/crypto v0.26.0 // indirect
 	golang.org/x/sys v0.23.0 // indirect
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 )
@@ -0,0 +1,100 @@
+package network
+
+import (
+	"blockchain/core"
+	"bytes"
+	"encoding/gob"
+	"log"
+)
+
+const magicLength = 4
+const commandLength = 12
+
+type version struct {
+	Version    int
+	BestHeight int
+	AddrFrom   string
+}
+
+type getblocks struct {
+	AddrFrom string
+}
+
+type inv struct {
+	AddrFrom string
+	Type     string
+	Items    [][]byte
+}
+
+type getdata struct {
+	AddrFrom string
+	Type     string
+	ID       []byte
+}
+
+type block struct {
+	AddrFrom string
+	Block    []byte
+}
+
+type tx struct {
+	AddrFrom    string
+	Transaction []byte
+}
+
+// commandToBytes pads command name to fixed length header
+func commandToBytes(command string) []byte {
+	var bytes [commandLength]byte
+
+	for i, c := range command {
+		bytes[i] = byte(c)
+	}
+
+	return bytes[:]
+}
+
+// bytesToCommand trims padding from command header
+func bytesToCommand(bytes []byte) string {
+	var command []byte
+
+	for _, b := range bytes {
+		if b != 0x0 {
+			command = append(command, b)
+		}
+	}
+
+	return string(command)
+}
+
+// extractCommand returns command header of the request
+func extractCommand(request []byte) []byte {
+	return request[magicLength : magicLength+commandLength]
+}
+
+// gobEncode serializes payload of a message
+func gobEncode(data any) []byte {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(data)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return buff.Bytes()
+}
+
+// gobDecode deserializes payload of a message
+func gobDecode(data []byte, payload any) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+
+	return dec.Decode(payload)
+}
+
+// newMessage joins network magic, command header and payload
+func newMessage(params *core.ChainParams, command string, payload any) []byte {
+	message := append([]byte{}, params.Magic[:]...)
+	message = append(message, commandToBytes(command)...)
+
+	return append(message, gobEncode(payload)...)
+}
@@ -0,0 +1,494 @@
+package network
+
+import (
+	"blockchain/core"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+const protocol = "tcp"
+const nodeVersion = 1
+
+// Server is a node which keeps its own blockchain in sync with known nodes
+type Server struct {
+	address      string
+	minerAddress string
+	bc           *core.Blockchain
+
+	mu              sync.Mutex
+	knownNodes      []string
+	blocksInTransit [][]byte
+	mempool         *core.Mempool
+	// resyncing holds nodes asked for their whole chain after they sent a block whose parent is unknown.
+	// If that doesn't connect their blocks either, their chain doesn't share genesis and they aren't asked again
+	resyncing map[string]bool
+
+	// mining is set while a goroutine mines blocks and stopMining aborts its current block
+	mining     bool
+	stopMining context.CancelFunc
+}
+
+// NewServer creates a node listening on address with the mempool saved in the blockchain file.
+// Blocks are mined and rewarded to minerAddress only if it is not empty
+func NewServer(address, minerAddress string, seeds []string, bc *core.Blockchain) (*Server, error) {
+	mempool, err := core.LoadMempool(bc)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		address:      address,
+		minerAddress: minerAddress,
+		bc:           bc,
+		mempool:      mempool,
+		resyncing:    make(map[string]bool),
+	}
+
+	for _, seed := range seeds {
+		if seed != "" && seed != address {
+			s.knownNodes = append(s.knownNodes, seed)
+		}
+	}
+
+	return s, nil
+}
+
+// Start listens for other nodes and handshakes with the seed nodes
+func (s *Server) Start() error {
+	ln, err := net.Listen(protocol, s.address)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	fmt.Printf("Node is listening on %s\n", s.address)
+	if s.minerAddress != "" {
+		fmt.Printf("Mining is on. Address to receive rewards: %s\n", s.minerAddress)
+		go s.mine()
+	}
+
+	for _, node := range s.nodes() {
+		s.sendVersion(node)
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+// SendTx sends a transaction to the node at address following the network of params
+func SendTx(address string, transaction *core.Transaction, params *core.ChainParams) error {
+	request := newMessage(params, "tx", tx{"", transaction.Serialize()})
+
+	return sendData(address, request)
+}
+
+func sendData(address string, data []byte) error {
+	conn, err := net.Dial(protocol, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = io.Copy(conn, bytes.NewReader(data))
+
+	return err
+}
+
+// send delivers data to a known node and forgets the node if it is not reachable
+func (s *Server) send(address string, data []byte) {
+	err := sendData(address, data)
+	if err != nil {
+		fmt.Printf("%s is not available\n", address)
+		s.removeNode(address)
+	}
+}
+
+func (s *Server) sendVersion(address string) {
+	bestHeight, err := s.bc.GetBestHeight()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	payload := version{nodeVersion, bestHeight, s.address}
+
+	s.send(address, newMessage(s.bc.Params(), "version", payload))
+}
+
+func (s *Server) sendGetBlocks(address string) {
+	s.send(address, newMessage(s.bc.Params(), "getblocks", getblocks{s.address}))
+}
+
+func (s *Server) sendInv(address, kind string, items [][]byte) {
+	s.send(address, newMessage(s.bc.Params(), "inv", inv{s.address, kind, items}))
+}
+
+func (s *Server) sendGetData(address, kind string, id []byte) {
+	s.send(address, newMessage(s.bc.Params(), "getdata", getdata{s.address, kind, id}))
+}
+
+func (s *Server) sendBlock(address string, b *core.Block) {
+	s.send(address, newMessage(s.bc.Params(), "block", block{s.address, b.Serialize()}))
+}
+
+func (s *Server) sendTx(address string, transaction *core.Transaction) {
+	s.send(address, newMessage(s.bc.Params(), "tx", tx{s.address, transaction.Serialize()}))
+}
+
+// broadcastInv announces items to every known node except the one they came from
+func (s *Server) broadcastInv(kind string, items [][]byte, except string) {
+	for _, node := range s.nodes() {
+		if node != except {
+			s.sendInv(node, kind, items)
+		}
+	}
+}
+
+func (s *Server) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	request, err := io.ReadAll(conn)
+	if err != nil || len(request) < magicLength+commandLength {
+		return
+	}
+	// Messages of other networks are dropped
+	magic := s.bc.Params().Magic
+	if !bytes.Equal(request[:magicLength], magic[:]) {
+		return
+	}
+	command := bytesToCommand(extractCommand(request))
+	payload := request[magicLength+commandLength:]
+
+	switch command {
+	case "version":
+		s.handleVersion(payload)
+	case "getblocks":
+		s.handleGetBlocks(payload)
+	case "inv":
+		s.handleInv(payload)
+	case "getdata":
+		s.handleGetData(payload)
+	case "block":
+		s.handleBlock(payload)
+	case "tx":
+		s.handleTx(payload)
+	default:
+		fmt.Printf("Unknown command: %s\n", command)
+	}
+}
+
+func (s *Server) handleVersion(request []byte) {
+	var payload version
+	if err := gobDecode(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	myBestHeight, err := s.bc.GetBestHeight()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	isNew := s.addNode(payload.AddrFrom)
+
+	if myBestHeight < payload.BestHeight {
+		s.sendGetBlocks(payload.AddrFrom)
+	} else if myBestHeight > payload.BestHeight || isNew {
+		s.sendVersion(payload.AddrFrom)
+	}
+}
+
+func (s *Server) handleGetBlocks(request []byte) {
+	var payload getblocks
+	if err := gobDecode(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Hashes are sent from genesis so the receiver always gets parents first
+	hashes, err := s.bc.GetBlockHashes()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for i, j := 0, len(hashes)-1; i < j; i, j = i+1, j-1 {
+		hashes[i], hashes[j] = hashes[j], hashes[i]
+	}
+
+	s.sendInv(payload.AddrFrom, "block", hashes)
+}
+
+func (s *Server) handleInv(request []byte) {
+	var payload inv
+	if err := gobDecode(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	switch payload.Type {
+	case "block":
+		var missing [][]byte
+		for _, hash := range payload.Items {
+			if _, err := s.bc.GetBlock(hash); err != nil {
+				missing = append(missing, hash)
+			}
+		}
+		if len(missing) == 0 {
+			return
+		}
+
+		s.mu.Lock()
+		s.blocksInTransit = missing[1:]
+		s.mu.Unlock()
+
+		s.sendGetData(payload.AddrFrom, "block", missing[0])
+	case "tx":
+		for _, txID := range payload.Items {
+			if !s.mempool.Has(txID) {
+				s.sendGetData(payload.AddrFrom, "tx", txID)
+			}
+		}
+	}
+}
+
+func (s *Server) handleGetData(request []byte) {
+	var payload getdata
+	if err := gobDecode(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	switch payload.Type {
+	case "block":
+		b, err := s.bc.GetBlock(payload.ID)
+		if err != nil {
+			return
+		}
+		s.sendBlock(payload.AddrFrom, &b)
+	case "tx":
+		transaction, ok := s.mempool.Get(payload.ID)
+		if ok {
+			s.sendTx(payload.AddrFrom, transaction)
+		}
+	}
+}
+
+func (s *Server) handleBlock(request []byte) {
+	var payload block
+	if err := gobDecode(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	b, err := core.DeserializeBlock(payload.Block)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	s.mu.Lock()
+	_, err = s.bc.GetBlock(b.Hash)
+	isNew := err != nil
+	if isNew {
+		update, err := s.bc.ImportBlock(b)
+		if errors.Is(err, core.ErrOrphanBlock) {
+			// Ask for the whole chain to get the missing parents, but only once
+			s.blocksInTransit = nil
+			resync := !s.resyncing[payload.AddrFrom]
+			s.resyncing[payload.AddrFrom] = true
+			s.mu.Unlock()
+			if resync {
+				s.sendGetBlocks(payload.AddrFrom)
+			} else {
+				fmt.Printf("Blocks of %s don't connect to this chain\n", payload.AddrFrom)
+			}
+			return
+		}
+		if err != nil {
+			fmt.Printf("Rejected block %x: %v\n", b.Hash, err)
+			s.blocksInTransit = nil
+			s.mu.Unlock()
+			return
+		}
+		delete(s.resyncing, payload.AddrFrom)
+		s.mempool.UpdateChain(update)
+		s.abortMining()
+		fmt.Printf("Received a new block %x\n", b.Hash)
+		if len(update.Disconnected) > 0 {
+			tip := update.Connected[len(update.Connected)-1]
+			fmt.Printf("Reorganized to %x at height %d, %d blocks were disconnected\n", tip.Hash, tip.Height, len(update.Disconnected))
+		}
+		if s.minerAddress != "" {
+			go s.mine()
+		}
+	}
+
+	var next []byte
+	if len(s.blocksInTransit) > 0 {
+		next = s.blocksInTransit[0]
+		s.blocksInTransit = s.blocksInTransit[1:]
+	}
+	s.mu.Unlock()
+
+	if isNew {
+		s.broadcastInv("block", [][]byte{b.Hash}, payload.AddrFrom)
+	}
+	if next != nil {
+		s.sendGetData(payload.AddrFrom, "block", next)
+	}
+}
+
+func (s *Server) handleTx(request []byte) {
+	var payload tx
+	if err := gobDecode(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	transaction, err := core.DeserializeTransaction(payload.Transaction)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	err = s.acceptTx(&transaction, payload.AddrFrom)
+	if err != nil && !errors.Is(err, core.ErrAlreadyInMempool) {
+		fmt.Printf("Rejected transaction: %v\n", err)
+	}
+}
+
+// SubmitTx adds a locally created transaction to mempool and announces it to known nodes
+func (s *Server) SubmitTx(transaction *core.Transaction) error {
+	return s.acceptTx(transaction, "")
+}
+
+// Mempool returns transactions of the node which are not in a block yet
+func (s *Server) Mempool() *core.Mempool {
+	return s.mempool
+}
+
+// acceptTx adds a transaction to mempool, relays it to every known node
+// except the one it came from and mines it if mining is on
+func (s *Server) acceptTx(transaction *core.Transaction, from string) error {
+	err := s.mempool.Add(transaction)
+	if err != nil {
+		return err
+	}
+
+	s.broadcastInv("tx", [][]byte{transaction.ID}, from)
+
+	if s.minerAddress != "" {
+		go s.mine()
+	}
+
+	return nil
+}
+
+// mine packs the mempool block template into new blocks and announces them to known nodes
+// until mempool is empty. Only one goroutine mines at a time
+func (s *Server) mine() {
+	s.mu.Lock()
+	if s.mining {
+		s.mu.Unlock()
+		return
+	}
+	s.mining = true
+
+	for s.mempool.Count() > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopMining = cancel
+		s.mu.Unlock()
+
+		newBlock, err := s.bc.MineBlock(ctx, s.minerAddress, s.mempool, reportHashRate)
+		cancel()
+
+		s.mu.Lock()
+		s.stopMining = nil
+		if errors.Is(err, context.Canceled) || errors.Is(err, core.ErrStaleTip) {
+			// A new block arrived, so mining starts over on top of it
+			continue
+		}
+		if errors.Is(err, core.ErrNotInTurn) {
+			// Another authority signs the next block, mining resumes when it arrives
+			break
+		}
+		if err != nil {
+			fmt.Printf("Mining failed: %v\n", err)
+
+			// Without the dropped transaction the next template can be mined. Any other
+			// error would come back with the same template, so mining waits for the next change
+			if errors.Is(err, core.ErrTxDropped) {
+				continue
+			}
+			break
+		}
+
+		fmt.Printf("Mined a new block %x\n", newBlock.Hash)
+		s.mu.Unlock()
+		s.broadcastInv("block", [][]byte{newBlock.Hash}, "")
+		s.mu.Lock()
+	}
+
+	s.mining = false
+	s.mu.Unlock()
+}
+
+// abortMining stops mining of the current block, which doesn't extend the last block any more.
+// The caller must hold s.mu
+func (s *Server) abortMining() {
+	if s.stopMining != nil {
+		s.stopMining()
+	}
+}
+
+func reportHashRate(hashesPerSecond float64) {
+	fmt.Printf("Mining at %.0f hashes per second\n", hashesPerSecond)
+}
+
+func (s *Server) nodes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.knownNodes...)
+}
+
+// addNode remembers a node and reports whether it was unknown
+func (s *Server) addNode(address string) bool {
+	if address == "" || address == s.address {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, node := range s.knownNodes {
+		if node == address {
+			return false
+		}
+	}
+	s.knownNodes = append(s.knownNodes, address)
+
+	return true
+}
+
+func (s *Server) removeNode(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, node := range s.knownNodes {
+		if node == address {
+			s.knownNodes = append(s.knownNodes[:i], s.knownNodes[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package network
+
+import (
+	"blockchain/core"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestNode creates a regtest node which knows seeds and whose wallet address has spendable outputs of n blocks
+func newTestNode(t *testing.T, seeds []string, n int) (*Server, string) {
+	t.Helper()
+
+	config := &core.Config{DataDir: t.TempDir(), Network: core.RegTest}
+	wallets, err := core.NewWallets(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := core.CreateBlockchain(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Db.Close() })
+	s, err := NewServer("localhost:0", "", seeds, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n > 0 {
+		mineTestBlocks(t, s, address, n+bc.Params().CoinbaseMaturity)
+	}
+
+	return s, address
+}
+
+// mineTestBlocks mines n blocks on the chain of s with its mempool, without announcing them
+func mineTestBlocks(t *testing.T, s *Server, address string, n int) []*core.Block {
+	t.Helper()
+
+	var blocks []*core.Block
+	for i := 0; i < n; i++ {
+		block, err := s.bc.MineBlock(context.Background(), address, s.mempool, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// newTestPeer listens for messages of a node and returns its address with the messages it receives
+func newTestPeer(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+
+	ln, err := net.Listen(protocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan []byte, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			message, err := io.ReadAll(conn)
+			conn.Close()
+			if err == nil {
+				messages <- message
+			}
+		}
+	}()
+
+	return ln.Addr().String(), messages
+}
+
+// expectMessage waits for the next message of a peer, which must have command, and decodes its payload
+func expectMessage(t *testing.T, messages <-chan []byte, command string, payload any) {
+	t.Helper()
+
+	select {
+	case message := <-messages:
+		if got := bytesToCommand(extractCommand(message)); got != command {
+			t.Fatalf("peer received %s, want %s", got, command)
+		}
+		err := gobDecode(message[magicLength+commandLength:], payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("peer received no %s", command)
+	}
+}
+
+// expectNoMessage checks a peer receives nothing for a while
+func expectNoMessage(t *testing.T, messages <-chan []byte) {
+	t.Helper()
+
+	select {
+	case message := <-messages:
+		t.Fatalf("peer received %s", bytesToCommand(extractCommand(message)))
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestHandleTx(t *testing.T) {
+	peer, messages := newTestPeer(t)
+	s, address := newTestNode(t, []string{peer}, 1)
+
+	transaction, err := core.NewUTXOTransaction(address, address, 1, 0, 0, &core.UTXOSet{Blockchain: s.bc, Mempool: s.mempool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.handleTx(gobEncode(tx{"other", transaction.Serialize()}))
+	if !s.mempool.Has(transaction.ID) {
+		t.Fatal("received transaction is not in mempool")
+	}
+
+	// Known nodes except the sender get the transaction announced and can ask for it
+	var announced inv
+	expectMessage(t, messages, "inv", &announced)
+	if announced.Type != "tx" || len(announced.Items) != 1 || !bytes.Equal(announced.Items[0], transaction.ID) {
+		t.Fatalf("peer got %s %x announced, want tx %x", announced.Type, announced.Items, transaction.ID)
+	}
+	s.handleGetData(gobEncode(getdata{peer, "tx", transaction.ID}))
+	var sent tx
+	expectMessage(t, messages, "tx", &sent)
+	if !bytes.Equal(sent.Transaction, transaction.Serialize()) {
+		t.Fatal("peer got another transaction")
+	}
+
+	// A transaction the node has already is neither added nor announced again
+	s.handleTx(gobEncode(tx{"other", transaction.Serialize()}))
+	expectNoMessage(t, messages)
+}
+
+func TestHandleBlock(t *testing.T) {
+	peer, messages := newTestPeer(t)
+	s, _ := newTestNode(t, []string{peer}, 0)
+	other, otherAddress := newTestNode(t, nil, 0)
+	blocks := mineTestBlocks(t, other, otherAddress, 2)
+
+	// The parent of the block is missing, so the sender is asked for its chain, but only once
+	s.handleBlock(gobEncode(block{peer, blocks[1].Serialize()}))
+	var request getblocks
+	expectMessage(t, messages, "getblocks", &request)
+	s.handleBlock(gobEncode(block{peer, blocks[1].Serialize()}))
+	expectNoMessage(t, messages)
+
+	for _, b := range blocks {
+		s.handleBlock(gobEncode(block{"other", b.Serialize()}))
+
+		var announced inv
+		expectMessage(t, messages, "inv", &announced)
+		if announced.Type != "block" || !bytes.Equal(announced.Items[0], b.Hash) {
+			t.Fatalf("peer got %s %x announced, want block %x", announced.Type, announced.Items, b.Hash)
+		}
+	}
+	height, err := s.bc.GetBestHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 2 {
+		t.Fatalf("height is %d after receiving 2 blocks, want 2", height)
+	}
+}
+
+func TestHandleVersion(t *testing.T) {
+	peer, messages := newTestPeer(t)
+	s, _ := newTestNode(t, nil, 0)
+
+	// A new node of the same height gets the version back to learn about this node
+	s.handleVersion(gobEncode(version{nodeVersion, 0, peer}))
+	var reply version
+	expectMessage(t, messages, "version", &reply)
+	if reply.AddrFrom != s.address {
+		t.Fatalf("version is from %s, want %s", reply.AddrFrom, s.address)
+	}
+	if nodes := s.nodes(); len(nodes) != 1 || nodes[0] != peer {
+		t.Fatalf("known nodes are %v, want %s", nodes, peer)
+	}
+
+	// A longer chain is asked for
+	s.handleVersion(gobEncode(version{nodeVersion, 1, peer}))
+	var request getblocks
+	expectMessage(t, messages, "getblocks", &request)
+}
+
+func TestMessageOfOtherNetworkIsDropped(t *testing.T) {
+	s, address := newTestNode(t, nil, 1)
+	transaction, err := core.NewUTXOTransaction(address, address, 1, 0, 0, &core.UTXOSet{Blockchain: s.bc, Mempool: s.mempool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testnet, err := (&core.Config{Network: core.TestNet}).Params()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, params := range []*core.ChainParams{testnet, s.bc.Params()} {
+		client, server := net.Pipe()
+		go func() {
+			client.Write(newMessage(params, "tx", tx{"other", transaction.Serialize()}))
+			client.Close()
+		}()
+		s.handleConnection(server)
+
+		if s.mempool.Has(transaction.ID) != (params == s.bc.Params()) {
+			t.Fatalf("transaction sent with the magic of %s is in mempool: %v", params.Name, s.mempool.Has(transaction.ID))
+		}
+	}
+}
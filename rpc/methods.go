@@ -0,0 +1,217 @@
+package rpc
+
+import (
+	"blockchain/core"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// unspentOutput is an entry of listunspent result
+type unspentOutput struct {
+	Txid    string `json:"txid"`
+	Vout    int    `json:"vout"`
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+// getBlockCount returns the height of the last block
+func getBlockCount(s *Server, params []json.RawMessage) (any, error) {
+	return s.bc.GetBestHeight()
+}
+
+// getBlock returns a block by its hash or by its height in the main chain
+func getBlock(s *Server, params []json.RawMessage) (any, error) {
+	if len(params) != 1 {
+		return nil, invalidParams("expected a block hash or height")
+	}
+
+	var height int
+	if err := json.Unmarshal(params[0], &height); err == nil {
+		return s.bc.GetBlockByHeight(height)
+	}
+
+	hash, err := hexParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.bc.GetBlock(hash)
+}
+
+// getRawTransaction returns a serialized transaction from mempool or the main chain
+func getRawTransaction(s *Server, params []json.RawMessage) (any, error) {
+	if len(params) != 1 {
+		return nil, invalidParams("expected a transaction id")
+	}
+	id, err := hexParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if tx, ok := s.node.Mempool().Get(id); ok {
+		return hex.EncodeToString(tx.Serialize()), nil
+	}
+
+	tx, err := s.bc.GetTransaction(id)
+	if err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString(tx.Serialize()), nil
+}
+
+// sendRawTransaction submits a serialized transaction and returns its id
+func sendRawTransaction(s *Server, params []json.RawMessage) (any, error) {
+	if len(params) != 1 {
+		return nil, invalidParams("expected a serialized transaction")
+	}
+	data, err := hexParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := core.DeserializeTransaction(data)
+	if err != nil {
+		return nil, invalidParams(err.Error())
+	}
+	err = s.node.SubmitTx(&tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.EncodeToString(tx.ID), nil
+}
+
+// getBalance returns the balance of an address which can be spent in the next block
+func getBalance(s *Server, params []json.RawMessage) (any, error) {
+	script, err := addressParam(s, params)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := core.UTXOSet{Blockchain: s.bc}
+	UTXOs, err := UTXOSet.FindUTXOs(script)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := 0
+	for _, out := range UTXOs {
+		balance += out.Value
+	}
+
+	return balance, nil
+}
+
+// listUnspent returns unspent outputs of an address which can be spent in the next block
+func listUnspent(s *Server, params []json.RawMessage) (any, error) {
+	script, err := addressParam(s, params)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := core.UTXOSet{Blockchain: s.bc}
+	unspentOutputs, err := UTXOSet.FindUnspentOutputs(script)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []unspentOutput{}
+	for _, unspent := range unspentOutputs {
+		result = append(result, unspentOutput{
+			Txid:    hex.EncodeToString(unspent.Txid),
+			Vout:    unspent.Index,
+			Address: unspent.Output.Address(s.bc.Params()),
+			Amount:  unspent.Output.Value,
+		})
+	}
+
+	return result, nil
+}
+
+// getNewAddress creates a wallet and returns its address
+func getNewAddress(s *Server, params []json.RawMessage) (any, error) {
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+
+	wallets, err := core.NewWallets(s.bc.Config())
+	if err != nil {
+		return nil, err
+	}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		return nil, err
+	}
+
+	return address, wallets.SaveToFile()
+}
+
+// sendToAddress pays amount and an optional fee from a wallet address to another address
+// and returns the id of the submitted transaction
+func sendToAddress(s *Server, params []json.RawMessage) (any, error) {
+	var from, to string
+	var amount, fee int
+	if len(params) < 3 || len(params) > 4 ||
+		json.Unmarshal(params[0], &from) != nil ||
+		json.Unmarshal(params[1], &to) != nil ||
+		json.Unmarshal(params[2], &amount) != nil || amount <= 0 {
+		return nil, invalidParams("expected from address, to address, a positive amount and an optional fee")
+	}
+	if len(params) == 4 && (json.Unmarshal(params[3], &fee) != nil || fee < 0) {
+		return nil, invalidParams("fee must not be negative")
+	}
+	if _, err := s.bc.Params().AddressScript(to); err != nil {
+		return nil, invalidParams(fmt.Sprintf("%s: %v", to, err))
+	}
+
+	// Outputs picked for tx count as spent only once tx is in the mempool,
+	// so the next send waits until then
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+
+	UTXOSet := core.UTXOSet{Blockchain: s.bc, Mempool: s.node.Mempool()}
+	tx, err := core.NewUTXOTransaction(from, to, amount, fee, 0, &UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.node.SubmitTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.EncodeToString(tx.ID), nil
+}
+
+func invalidParams(message string) *Error {
+	return &Error{codeInvalidParams, message}
+}
+
+func hexParam(params []json.RawMessage, i int) ([]byte, error) {
+	var value string
+	if err := json.Unmarshal(params[i], &value); err != nil {
+		return nil, invalidParams(fmt.Sprintf("param %d is not a string", i))
+	}
+
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, invalidParams(fmt.Sprintf("param %d is not hex", i))
+	}
+
+	return data, nil
+}
+
+// addressParam decodes the only param as an address of the node network
+// and returns the script locking outputs to it
+func addressParam(s *Server, params []json.RawMessage) ([]byte, error) {
+	var address string
+	if len(params) != 1 || json.Unmarshal(params[0], &address) != nil {
+		return nil, invalidParams("expected an address")
+	}
+
+	script, err := s.bc.Params().AddressScript(address)
+	if err != nil {
+		return nil, invalidParams(fmt.Sprintf("%s: %v", address, err))
+	}
+
+	return script, nil
+}
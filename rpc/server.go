@@ -0,0 +1,182 @@
+package rpc
+
+import (
+	"blockchain/core"
+	"blockchain/network"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Error codes defined by JSON-RPC 2.0
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// codeServerError is returned when a method fails
+const codeServerError = -32000
+
+type request struct {
+	JSONRPC string            `json:"jsonrpc"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+	ID      json.RawMessage   `json:"id"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Error is the error object of a JSON-RPC response
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type handler func(s *Server, params []json.RawMessage) (any, error)
+
+var handlers = map[string]handler{
+	"getblockcount":      getBlockCount,
+	"getblock":           getBlock,
+	"getrawtransaction":  getRawTransaction,
+	"sendrawtransaction": sendRawTransaction,
+	"getbalance":         getBalance,
+	"listunspent":        listUnspent,
+	"getnewaddress":      getNewAddress,
+	"sendtoaddress":      sendToAddress,
+}
+
+// Server answers JSON-RPC 2.0 requests sent over HTTP with basic auth
+type Server struct {
+	address  string
+	user     string
+	password string
+	bc       *core.Blockchain
+	node     *network.Server
+
+	// walletMu serializes access to the wallet file and spends of its outputs
+	walletMu sync.Mutex
+}
+
+// NewServer creates a JSON-RPC server listening on address.
+// Transactions are submitted to mempool of node
+func NewServer(address, user, password string, bc *core.Blockchain, node *network.Server) *Server {
+	return &Server{
+		address:  address,
+		user:     user,
+		password: password,
+		bc:       bc,
+		node:     node,
+	}
+}
+
+// Start serves requests until the listener fails
+func (s *Server) Start() error {
+	fmt.Printf("JSON-RPC server is listening on %s\n", s.address)
+
+	return http.ListenAndServe(s.address, s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req request
+	var resp *response
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		resp = &response{Error: &Error{codeParseError, err.Error()}, ID: json.RawMessage("null")}
+	} else {
+		resp = s.call(&req)
+	}
+
+	// Requests without id are notifications and get no response
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp.JSONRPC = "2.0"
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		fmt.Printf("Failed to write response: %v\n", err)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+	return userOK && passwordOK
+}
+
+// call runs the method of a request and returns its response
+func (s *Server) call(req *request) (resp *response) {
+	id := req.ID
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	resp = &response{ID: id}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &Error{codeInvalidRequest, "invalid request"}
+		return resp
+	}
+	method, ok := handlers[req.Method]
+	if !ok {
+		resp.Error = &Error{codeMethodNotFound, fmt.Sprintf("method %s is not found", req.Method)}
+		return resp
+	}
+
+	// A failing handler must not take the node down
+	defer func() {
+		if r := recover(); r != nil {
+			resp.Result = nil
+			resp.Error = &Error{codeInternalError, fmt.Sprint(r)}
+		}
+		if len(req.ID) == 0 {
+			resp = nil
+		}
+	}()
+
+	result, err := method(s, req.Params)
+	if err != nil {
+		if rpcErr, ok := err.(*Error); ok {
+			resp.Error = rpcErr
+		} else {
+			resp.Error = &Error{codeServerError, err.Error()}
+		}
+		return resp
+	}
+	resp.Result, err = json.Marshal(result)
+	if err != nil {
+		resp.Error = &Error{codeInternalError, err.Error()}
+	}
+
+	return resp
+}
@@ -0,0 +1,208 @@
+package rpc
+
+import (
+	"blockchain/core"
+	"blockchain/network"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// newTestServer creates a regtest node whose wallet address has spendable outputs of n blocks
+// and returns a JSON-RPC server of the node with the address
+func newTestServer(t *testing.T, n int) (*Server, string) {
+	t.Helper()
+
+	config := &core.Config{DataDir: t.TempDir(), Network: core.RegTest}
+	wallets, err := core.NewWallets(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := core.CreateBlockchain(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Db.Close() })
+	node, err := network.NewServer("localhost:0", "", nil, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n+bc.Params().CoinbaseMaturity; i++ {
+		_, err := bc.MineBlock(context.Background(), address, node.Mempool(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewServer("localhost:0", "user", "password", bc, node), address
+}
+
+// post sends body to s as an authorized request and returns the HTTP response
+func post(s *Server, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	r.SetBasicAuth("user", "password")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	return w
+}
+
+// call runs a method on s and returns its response
+func call(t *testing.T, s *Server, method string, params ...any) *response {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": method, "params": params, "id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := post(s, string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s returned HTTP status %d", method, w.Code)
+	}
+
+	var resp response
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &resp
+}
+
+func TestServeHTTP(t *testing.T) {
+	s, _ := newTestServer(t, 0)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("user", "password")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET returned HTTP status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","method":"getblockcount","id":1}`))
+	r.SetBasicAuth("user", "wrong")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password returned HTTP status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if w := post(s, `{"jsonrpc":"2.0","method":"getblockcount"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("notification returned HTTP status %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"malformed JSON", `{"jsonrpc":`, codeParseError},
+		{"no version", `{"method":"getblockcount","id":1}`, codeInvalidRequest},
+		{"unknown method", `{"jsonrpc":"2.0","method":"stop","id":1}`, codeMethodNotFound},
+		{"wrong params", `{"jsonrpc":"2.0","method":"getblock","params":[],"id":1}`, codeInvalidParams},
+		{"failing method", `{"jsonrpc":"2.0","method":"getblock","params":["00"],"id":1}`, codeServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp response
+			err := json.NewDecoder(post(s, tt.body).Body).Decode(&resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error == nil || resp.Error.Code != tt.code {
+				t.Fatalf("error is %+v, want code %d", resp.Error, tt.code)
+			}
+		})
+	}
+}
+
+func TestGetBlock(t *testing.T) {
+	s, _ := newTestServer(t, 1)
+
+	var height int
+	resp := call(t, s, "getblockcount")
+	if resp.Error != nil || json.Unmarshal(resp.Result, &height) != nil {
+		t.Fatalf("getblockcount returned %s, %+v", resp.Result, resp.Error)
+	}
+	last, err := s.bc.GetBlockByHeight(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, param := range []any{height, hex.EncodeToString(last.Hash)} {
+		var block struct{ Hash string }
+		resp := call(t, s, "getblock", param)
+		if resp.Error != nil || json.Unmarshal(resp.Result, &block) != nil {
+			t.Fatalf("getblock %v returned %s, %+v", param, resp.Result, resp.Error)
+		}
+		if block.Hash != hex.EncodeToString(last.Hash) {
+			t.Fatalf("getblock %v returned block %s, want %x", param, block.Hash, last.Hash)
+		}
+	}
+}
+
+func TestSendToAddress(t *testing.T) {
+	const sends = 5
+	s, address := newTestServer(t, sends)
+
+	resp := call(t, s, "sendtoaddress", address, address, 0)
+	if resp.Error == nil || resp.Error.Code != codeInvalidParams {
+		t.Fatalf("sendtoaddress of no coins returned %+v, want code %d", resp.Error, codeInvalidParams)
+	}
+
+	// Concurrent sends must not pick the same outputs
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","method":"sendtoaddress","params":[%q,%q,1],"id":1}`, address, address)
+	var wg sync.WaitGroup
+	ids := make([]string, sends)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var resp response
+			err := json.NewDecoder(post(s, body).Body).Decode(&resp)
+			if err != nil || resp.Error != nil || json.Unmarshal(resp.Result, &ids[i]) != nil {
+				t.Errorf("sendtoaddress returned %s, %+v, %v", resp.Result, resp.Error, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if count := s.node.Mempool().Count(); count != sends {
+		t.Fatalf("mempool has %d transactions, want %d", count, sends)
+	}
+
+	var raw string
+	resp = call(t, s, "getrawtransaction", ids[0])
+	if resp.Error != nil || json.Unmarshal(resp.Result, &raw) != nil {
+		t.Fatalf("getrawtransaction returned %s, %+v", resp.Result, resp.Error)
+	}
+	data, err := hex.DecodeString(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := core.DeserializeTransaction(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(tx.ID) != ids[0] {
+		t.Fatalf("getrawtransaction returned transaction %x, want %s", tx.ID, ids[0])
+	}
+}